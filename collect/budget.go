@@ -0,0 +1,18 @@
+package collect
+
+import "time"
+
+// Budget 任务每次运行的预算，为 0 的项不限制。
+// 超出页面数、字节数、数据条数或运行时间时，任务停止并丢弃剩余的请求；超出单个域名的页面数时，只跳过该域名的请求。
+type Budget struct {
+	MaxPages        int64         `json:"max_pages"`          // 最多抓取的页面数
+	MaxBytes        int64         `json:"max_bytes"`          // 最多下载的字节数
+	MaxItems        int64         `json:"max_items"`          // 最多解析得到的数据条数
+	MaxDuration     time.Duration `json:"max_duration"`       // 最长运行时间
+	MaxPagesPerHost int64         `json:"max_pages_per_host"` // 每个域名最多抓取的页面数
+}
+
+// Enabled 是否设置了预算
+func (b Budget) Enabled() bool {
+	return b.MaxPages > 0 || b.MaxBytes > 0 || b.MaxItems > 0 || b.MaxDuration > 0 || b.MaxPagesPerHost > 0
+}
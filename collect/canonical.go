@@ -0,0 +1,129 @@
+package collect
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// URL 规范化
+// 同一个页面可能有多种写法，例如查询参数顺序不同、带有锚点或统计参数。
+// 任务可以配置规范化选项，请求去重时使用规范化后的 URL，也可以通过 Task.Fingerprint 自定义请求指纹。
+
+// CanonicalOptions URL 规范化选项，默认不做任何处理
+type CanonicalOptions struct {
+	StripFragment bool     `json:"strip_fragment"` // 去掉 # 之后的部分
+	SortQuery     bool     `json:"sort_query"`     // 按参数名排序查询参数
+	DropParams    []string `json:"drop_params"`    // 去掉的查询参数，以 * 结尾时按前缀匹配，如 utm_*
+	NormalizeHost bool     `json:"normalize_host"` // scheme 和 host 转为小写并去掉默认端口
+	CleanPath     bool     `json:"clean_path"`     // 解析路径中的 . 和 ..，去掉末尾的 /，空路径统一为 /
+}
+
+// DefaultCanonical 常用的规范化选项，只去掉通用的统计参数，网站特有的参数由任务通过 Drop 添加
+var DefaultCanonical = CanonicalOptions{
+	StripFragment: true,
+	SortQuery:     true,
+	DropParams:    []string{"utm_*", "spm"},
+	NormalizeHost: true,
+	CleanPath:     true,
+}
+
+// Drop 返回额外去掉 params 参数的选项，不修改原有的选项
+func (o CanonicalOptions) Drop(params ...string) CanonicalOptions {
+	o.DropParams = append(append([]string(nil), o.DropParams...), params...)
+	return o
+}
+
+func (o CanonicalOptions) enabled() bool {
+	return o.StripFragment || o.SortQuery || len(o.DropParams) > 0 || o.NormalizeHost || o.CleanPath
+}
+
+// Canonicalize 按选项规范化 URL，无法解析的 URL 原样返回
+func Canonicalize(rawurl string, opts CanonicalOptions) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	if opts.StripFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	if opts.NormalizeHost {
+		u.Scheme = strings.ToLower(u.Scheme)
+		host := strings.ToLower(u.Hostname())
+		port := u.Port()
+		if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+			port = ""
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if port != "" {
+			host += ":" + port
+		}
+		u.Host = host
+	}
+	if opts.CleanPath && u.Opaque == "" {
+		// 空路径和 / 是同一个页面
+		u.Path = path.Clean("/" + u.Path)
+		u.RawPath = ""
+	}
+	if len(opts.DropParams) > 0 || opts.SortQuery {
+		u.RawQuery = canonicalQuery(u.RawQuery, opts)
+	}
+	return u.String()
+}
+
+// canonicalQuery 去掉指定的参数，按需排序。排序时相同参数名的值保持原有顺序
+func canonicalQuery(raw string, opts CanonicalOptions) string {
+	if raw == "" {
+		return ""
+	}
+	parts := strings.Split(raw, "&")
+	kept := parts[:0]
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		name := part
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name = part[:i]
+		}
+		if key, err := url.QueryUnescape(name); err == nil {
+			name = key
+		}
+		if dropParam(name, opts.DropParams) {
+			continue
+		}
+		kept = append(kept, part)
+	}
+	if opts.SortQuery {
+		sort.SliceStable(kept, func(i, j int) bool {
+			return paramName(kept[i]) < paramName(kept[j])
+		})
+	}
+	return strings.Join(kept, "&")
+}
+
+func paramName(part string) string {
+	if i := strings.IndexByte(part, '='); i >= 0 {
+		return part[:i]
+	}
+	return part
+}
+
+func dropParam(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+			continue
+		}
+		if name == p {
+			return true
+		}
+	}
+	return false
+}
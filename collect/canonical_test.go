@@ -0,0 +1,46 @@
+package collect_test
+
+import (
+	"github.com/nico612/crawler-go/collect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalize(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"https://Book.Douban.com:443/tag/../tag/小说/?start=0&type=T#comments", "https://book.douban.com/tag/%E5%B0%8F%E8%AF%B4?start=0&type=T"},
+		{"http://example.com:80/a/./b/?x=1&start=20&utm_source=feed&utm_medium=rss", "http://example.com/a/b?start=20&x=1"},
+		{"http://example.com:8080", "http://example.com:8080/"},
+		{"http://example.com", "http://example.com/"},
+		{"http://example.com/", "http://example.com/"},
+		{"http://example.com?from=feed", "http://example.com/?from=feed"},
+		{"http://example.com/?b=2&a=1&b=1", "http://example.com/?a=1&b=2&b=1"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, collect.Canonicalize(c.in, collect.DefaultCanonical), c.in)
+	}
+	douban := collect.DefaultCanonical.Drop("from")
+	assert.Equal(t, "https://book.douban.com/subject/1", collect.Canonicalize("https://book.douban.com/subject/1/?from=tag", douban))
+	assert.Equal(t, []string{"utm_*", "spm"}, collect.DefaultCanonical.DropParams)
+	assert.Equal(t, "http://Example.com/a/?b=1&a=2#x",
+		collect.Canonicalize("http://Example.com/a/?b=1&a=2#x", collect.CanonicalOptions{}))
+}
+
+func TestRequestUnique(t *testing.T) {
+	task := &collect.Task{Property: collect.Property{Canonical: collect.DefaultCanonical}}
+	a := &collect.Request{Task: task, Url: "https://www.douban.com/group/szsh/discussion?start=0&x=1", Method: "GET"}
+	b := &collect.Request{Task: task, Url: "https://www.douban.com/group/szsh/discussion/?x=1&start=0#top"}
+	assert.Equal(t, a.Unique(), b.Unique())
+
+	raw := &collect.Task{}
+	c := &collect.Request{Task: raw, Url: a.Url, Method: "GET"}
+	d := &collect.Request{Task: raw, Url: b.Url, Method: "GET"}
+	assert.NotEqual(t, c.Unique(), d.Unique())
+
+	custom := &collect.Task{Fingerprint: func(r *collect.Request) string { return r.RuleName }}
+	e := &collect.Request{Task: custom, Url: a.Url, RuleName: "list"}
+	assert.Equal(t, "list", e.Unique())
+}
@@ -2,7 +2,6 @@ package collect
 
 import (
 	"bufio"
-	"fmt"
 	extensions "github.com/nico612/crawler-go/extension"
 	"github.com/nico612/crawler-go/proxy"
 	"go.uber.org/zap"
@@ -18,28 +17,64 @@ import (
 // 采集引擎
 
 type Fetcher interface {
-	// Get 读取链接内容
-	Get(req *Request) ([]byte, error)
+	// Get 读取链接内容，状态码不做判断，由调用方校验
+	Get(req *Request) (*Response, error)
+}
+
+// Response 请求的响应
+type Response struct {
+	StatusCode  int
+	Header      http.Header
+	Body        []byte        // 转换为 UTF-8 编码后的内容
+	URL         string        // 跟随重定向后最终的地址
+	ContentType string        // 响应的 Content-Type
+	Duration    time.Duration // 从发出请求到读取完响应内容的耗时
 }
 
 type BaseFetch struct {
 }
 
-func (BaseFetch) Get(req *Request) ([]byte, error) {
-	resp, err := http.Get(req.Url)
+func (BaseFetch) Get(req *Request) (*Response, error) {
+	r, cancel, err := req.NewHTTPRequest()
 	if err != nil {
 		return nil, err
 	}
+	defer cancel()
 
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("Error status code:%d\n", resp.StatusCode)
+	client := http.DefaultClient
+	if jar := req.Jar(); jar != nil {
+		client = &http.Client{Jar: jar}
+	}
+	start := time.Now()
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, err
 	}
 
+	defer resp.Body.Close()
+	return readResponse(resp, start)
+}
+
+// readResponse 读取响应内容并转换为 UTF-8 编码，start 为发出请求的时间
+func readResponse(resp *http.Response, start time.Time) (*Response, error) {
 	bodyReader := bufio.NewReader(resp.Body)
 	e := DeterminEncoding(bodyReader)
 	utf8Reader := transform.NewReader(bodyReader, e.NewDecoder())
-	return io.ReadAll(utf8Reader)
+	body, err := io.ReadAll(utf8Reader)
+	if err != nil {
+		return nil, err
+	}
+	r := &Response{
+		StatusCode:  resp.StatusCode,
+		Header:      resp.Header,
+		Body:        body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Duration:    time.Since(start),
+	}
+	if resp.Request != nil {
+		r.URL = resp.Request.URL.String()
+	}
+	return r, nil
 }
 
 // BrowserFetch 模拟浏览器
@@ -50,9 +85,10 @@ type BrowserFetch struct {
 }
 
 // Get 模拟浏览器访问
-func (b BrowserFetch) Get(request *Request) ([]byte, error) {
+func (b BrowserFetch) Get(request *Request) (*Response, error) {
 	client := &http.Client{
-		Timeout: b.Timeout,
+		Timeout: request.timeoutOr(b.Timeout),
+		Jar:     request.Jar(),
 	}
 
 	// 更新 http.Client 变量中的 Transport 结构中的 Proxy 函数，将其替换为我们自定义的代理函数。
@@ -62,18 +98,22 @@ func (b BrowserFetch) Get(request *Request) ([]byte, error) {
 		client.Transport = transport
 	}
 
-	req, err := http.NewRequest("GET", request.Url, nil)
+	req, cancel, err := request.NewHTTPRequest()
 	if err != nil {
 		return nil, err
 	}
+	defer cancel()
 
-	if len(request.Task.Cookie) > 0 {
+	if len(request.Task.Cookie) > 0 && req.Header.Get("Cookie") == "" {
 		req.Header.Set("Cookie", request.Task.Cookie)
 	}
 
 	// 随机 User-Agent 模拟多端访问
-	req.Header.Set("User-Agent", extensions.GenerateRandomUA())
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", extensions.GenerateRandomUA())
+	}
 
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
 		b.Logger.Error("fetch failed",
@@ -83,22 +123,14 @@ func (b BrowserFetch) Get(request *Request) ([]byte, error) {
 	}
 
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("Error status code:%d\n", resp.StatusCode)
-	}
-
-	bodyReader := bufio.NewReader(resp.Body)
-	e := DeterminEncoding(bodyReader)
-	utf8Reader := transform.NewReader(bodyReader, e.NewDecoder())
-	return io.ReadAll(utf8Reader)
-
+	return readResponse(resp, start)
 }
 
 // DeterminEncoding 检测并返回当前 HTML 文本的编码格式
 func DeterminEncoding(r *bufio.Reader) encoding.Encoding {
-	bytes, err := r.Peek(1024)
-	if err != nil {
-		fmt.Printf("fetch error: %v", err)
+	// 内容不足 1024 字节时 Peek 返回已有的内容和 io.EOF
+	bytes, _ := r.Peek(1024)
+	if len(bytes) == 0 {
 		return unicode.UTF8
 	}
 
@@ -0,0 +1,147 @@
+package collect
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 构造 HTTP 请求
+// 所有抓取器都通过 NewHTTPRequest 构造 http.Request，保证请求的方法、查询参数、请求头、请求体和超时时间在各个抓取器中一致。
+
+// FullURL 返回合并了 Query 的请求地址
+func (r *Request) FullURL() string {
+	if len(r.Query) == 0 {
+		return r.Url
+	}
+	u, err := url.Parse(r.Url)
+	if err != nil {
+		return r.Url
+	}
+	q := u.Query()
+	for k, vs := range r.Query {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// HTTPMethod 返回请求方法，未设置时有请求体的请求使用 POST，否则使用 GET
+func (r *Request) HTTPMethod() string {
+	if r.Method != "" {
+		return strings.ToUpper(r.Method)
+	}
+	if r.Body != nil || r.JSON != nil || r.Form != nil {
+		return http.MethodPost
+	}
+	return http.MethodGet
+}
+
+// body 返回请求体和对应的 Content-Type，Body、JSON、Form 同时设置时依次优先使用
+func (r *Request) body() ([]byte, string, error) {
+	switch {
+	case r.Body != nil:
+		return r.Body, "", nil
+	case r.JSON != nil:
+		b, err := json.Marshal(r.JSON)
+		return b, "application/json; charset=utf-8", err
+	case r.Form != nil:
+		return []byte(r.Form.Encode()), "application/x-www-form-urlencoded", nil
+	}
+	return nil, "", nil
+}
+
+// NewHTTPRequest 构造 http.Request。
+// 条件请求头和 Header 中的请求头最后设置，覆盖抓取器设置的默认值，因此抓取器应当只在请求头不存在时设置默认值。
+// 设置了 Timeout 时请求带有超时，读取完响应后需要调用返回的 cancel。
+func (r *Request) NewHTTPRequest() (*http.Request, context.CancelFunc, error) {
+	body, contentType, err := r.body()
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if r.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.HTTPMethod(), r.FullURL(), reader)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	r.setConditional(req.Header)
+	r.setHeader(req.Header)
+	return req, cancel, nil
+}
+
+// fingerprint 请求头和请求体的摘要，都为空时返回空字符串，不影响只有 URL 和 Method 的请求原有的识别码
+func (r *Request) fingerprint() string {
+	body, _, _ := r.body()
+	if len(r.Header) == 0 && body == nil {
+		return ""
+	}
+	// 直接赋值的请求头可能不是规范的形式，按规范形式合并后再计算
+	raw := make([]string, 0, len(r.Header))
+	for k := range r.Header {
+		raw = append(raw, k)
+	}
+	sort.Strings(raw)
+	header := make(http.Header, len(raw))
+	for _, k := range raw {
+		ck := http.CanonicalHeaderKey(k)
+		header[ck] = append(header[ck], r.Header[k]...)
+	}
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteString(":")
+		b.WriteString(strings.Join(header[k], ","))
+		b.WriteString("\n")
+	}
+	b.Write(body)
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// Jar 返回请求使用的会话，任务没有会话时返回 nil。
+// 请求第一次使用会话时轮流选择一个会话并记录在 Session 中，重试时使用同一个会话。
+func (r *Request) Jar() http.CookieJar {
+	if r.Task == nil || r.Task.Sessions == nil {
+		return nil
+	}
+	if s := r.Task.Sessions.Get(r.Session); s != nil {
+		return s
+	}
+	s := r.Task.Sessions.Next()
+	r.Session = s.Name
+	return s
+}
+
+// timeoutOr 请求设置了超时时间时返回请求的超时时间，否则返回 d
+func (r *Request) timeoutOr(d time.Duration) time.Duration {
+	if r.Timeout > 0 {
+		return r.Timeout
+	}
+	return d
+}
@@ -0,0 +1,92 @@
+package collect_test
+
+import (
+	"github.com/nico612/crawler-go/collect"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPRequest(t *testing.T) {
+	task := &collect.Task{}
+	req := &collect.Request{
+		Task:   task,
+		Url:    "https://www.douban.com/search?cat=1001",
+		Query:  url.Values{"q": {"活着"}},
+		Header: http.Header{"Referer": {"https://www.douban.com"}},
+		Form:   url.Values{"name": {"douban"}},
+	}
+	r, cancel, err := req.NewHTTPRequest()
+	require.NoError(t, err)
+	defer cancel()
+	assert.Equal(t, http.MethodPost, r.Method)
+	assert.Equal(t, "https://www.douban.com/search?cat=1001&q=%E6%B4%BB%E7%9D%80", r.URL.String())
+	assert.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+	assert.Equal(t, "https://www.douban.com", r.Header.Get("Referer"))
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "name=douban", string(body))
+
+	req = &collect.Request{Task: task, Url: "https://www.douban.com/api", Method: "put", JSON: map[string]int{"start": 20}}
+	r, cancel, err = req.NewHTTPRequest()
+	require.NoError(t, err)
+	defer cancel()
+	assert.Equal(t, http.MethodPut, r.Method)
+	assert.Equal(t, "application/json; charset=utf-8", r.Header.Get("Content-Type"))
+	body, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"start":20}`, string(body))
+}
+
+func TestRequestUniqueBody(t *testing.T) {
+	task := &collect.Task{}
+	get := &collect.Request{Task: task, Url: "https://www.douban.com/api"}
+	a := &collect.Request{Task: task, Url: "https://www.douban.com/api", JSON: map[string]int{"start": 0}}
+	b := &collect.Request{Task: task, Url: "https://www.douban.com/api", JSON: map[string]int{"start": 20}}
+	c := &collect.Request{Task: task, Url: "https://www.douban.com/api", JSON: map[string]int{"start": 20}}
+	assert.NotEqual(t, get.Unique(), a.Unique())
+	assert.NotEqual(t, a.Unique(), b.Unique())
+	assert.Equal(t, b.Unique(), c.Unique())
+}
+
+func TestRequestUniqueHeader(t *testing.T) {
+	task := &collect.Task{}
+	set := &collect.Request{Task: task, Url: "https://www.douban.com/api", Header: http.Header{}}
+	set.Header.Set("X-Token", "a")
+	// 直接赋值的请求头不是规范形式，仍然得到相同的识别码
+	raw := &collect.Request{Task: task, Url: "https://www.douban.com/api", Header: http.Header{"x-token": {"a"}}}
+	other := &collect.Request{Task: task, Url: "https://www.douban.com/api", Header: http.Header{"x-token": {"b"}}}
+	assert.Equal(t, set.Unique(), raw.Unique())
+	assert.NotEqual(t, raw.Unique(), other.Unique())
+}
+
+func TestBaseFetchResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("<html>not found</html>"))
+	}))
+	defer srv.Close()
+
+	req := &collect.Request{Task: &collect.Task{}, Url: srv.URL + "/old"}
+	resp, err := collect.BaseFetch{}.Get(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, srv.URL+"/new", resp.URL)
+	assert.Equal(t, "text/html; charset=utf-8", resp.ContentType)
+	assert.Equal(t, "<html>not found</html>", string(resp.Body))
+	assert.Greater(t, int64(resp.Duration), int64(0))
+
+	assert.Error(t, req.Validate(resp))
+	req.Task.StatusPolicy = collect.StatusParse
+	assert.NoError(t, req.Validate(resp))
+}
@@ -0,0 +1,219 @@
+package collect
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 增量抓取
+// 开启 Incremental 的任务会记录每个页面的 ETag、Last-Modified 和内容哈希，
+// 再次抓取时发送 If-None-Match、If-Modified-Since，服务端返回 304 时视为页面未变化，不再解析。
+// 同时开启 SkipUnchanged 时，内容哈希与上次相同的页面也不再解析。
+
+// PageState 上次抓取时页面的状态
+type PageState struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Hash         string    `json:"hash"` // 响应内容的 sha256
+	Time         time.Time `json:"time"`
+}
+
+// PageCache 页面状态储存，实现需要保证并发安全
+type PageCache interface {
+	Get(key string) (PageState, bool)
+	Set(key string, state PageState) error
+}
+
+// pageKey 页面状态的键，同一任务的不同运行共享页面状态
+func (r *Request) pageKey() string {
+	return r.Task.Name + ":" + r.Unique()
+}
+
+// setConditional 为开启增量抓取的请求设置条件请求头
+func (r *Request) setConditional(h http.Header) {
+	if !r.Task.Incremental || r.Task.Cache == nil {
+		return
+	}
+	state, ok := r.Task.Cache.Get(r.pageKey())
+	if !ok {
+		return
+	}
+	if state.ETag != "" {
+		h.Set("If-None-Match", state.ETag)
+	}
+	if state.LastModified != "" {
+		h.Set("If-Modified-Since", state.LastModified)
+	}
+}
+
+// NotModified 服务端是否返回了页面未变化
+func (r *Request) NotModified(resp *Response) bool {
+	return r.Task.Incremental && resp.StatusCode == http.StatusNotModified
+}
+
+// Unchanged 检查校验通过的响应，返回页面当前的状态，以及是否因为内容与上次相同而跳过解析。
+// 未开启增量抓取时返回 nil。页面状态在解析结果处理完后才由 SavePageState 记录，处理失败的页面下次仍会重新解析。
+func (r *Request) Unchanged(resp *Response) (*PageState, bool) {
+	if !r.Task.Incremental || r.Task.Cache == nil {
+		return nil, false
+	}
+	sum := sha256.Sum256(resp.Body)
+	state := &PageState{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Hash:         hex.EncodeToString(sum[:]),
+		Time:         time.Now(),
+	}
+	last, ok := r.Task.Cache.Get(r.pageKey())
+	return state, r.Task.SkipUnchanged && ok && last.Hash == state.Hash
+}
+
+// SavePageState 记录页面的状态，state 为 nil 时不做任何事
+func (r *Request) SavePageState(state *PageState) error {
+	if state == nil || r.Task.Cache == nil {
+		return nil
+	}
+	return r.Task.Cache.Set(r.pageKey(), *state)
+}
+
+// MemoryPageCache 储存在内存中的页面状态
+type MemoryPageCache struct {
+	mu     sync.RWMutex
+	states map[string]PageState
+}
+
+func NewMemoryPageCache() *MemoryPageCache {
+	return &MemoryPageCache{states: make(map[string]PageState)}
+}
+
+func (m *MemoryPageCache) Get(key string) (PageState, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.states[key]
+	return s, ok
+}
+
+func (m *MemoryPageCache) Set(key string, state PageState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[key] = state
+	return nil
+}
+
+// pageEntry 页面状态文件中的一行
+type pageEntry struct {
+	Key   string    `json:"key"`
+	State PageState `json:"state"`
+}
+
+// pageCompactInterval 追加的记录数超过该值且多于页面数时重写文件
+const pageCompactInterval = 10000
+
+// FilePageCache 持久化到文件的页面状态，文件每行一条 JSON 记录，相同页面以最后一条为准
+type FilePageCache struct {
+	MemoryPageCache
+	path    string
+	file    *os.File
+	appends int // 上次重写后追加的记录数
+}
+
+// NewFilePageCache 打开 path 对应的页面状态文件并加载已有的记录
+func NewFilePageCache(path string) (*FilePageCache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	c := &FilePageCache{
+		MemoryPageCache: MemoryPageCache{states: make(map[string]PageState)},
+		path:            path,
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	if err := c.rewrite(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *FilePageCache) load() error {
+	f, err := os.Open(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e pageEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		c.states[e.Key] = e.State
+	}
+	return scanner.Err()
+}
+
+// rewrite 将内存中的页面状态重新写入文件
+func (c *FilePageCache) rewrite() error {
+	tmp := c.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for key, state := range c.states {
+		if err := enc.Encode(pageEntry{Key: key, State: state}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+
+	if c.file != nil {
+		c.file.Close()
+	}
+	c.file, err = os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	c.appends = 0
+	return err
+}
+
+func (c *FilePageCache) Set(key string, state PageState) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.states[key] = state
+	if c.appends > pageCompactInterval && c.appends > len(c.states) {
+		return c.rewrite()
+	}
+	c.appends++
+	return json.NewEncoder(c.file).Encode(pageEntry{Key: key, State: state})
+}
+
+// Close 关闭页面状态文件
+func (c *FilePageCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
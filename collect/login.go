@@ -0,0 +1,214 @@
+package collect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 登录
+// 需要登录的网站在任务开始前使用每个会话分别登录，登录后的 cookie 保存在会话中。
+// 可以先访问登录页提取 CSRF token，再以表单或 JSON 提交登录字段；字段的值中 ${name} 会被替换为凭据，
+// 凭据从环境变量或密钥文件中读取，不写在代码和规则中。
+// 抓取过程中响应满足失效条件时，引擎使用该会话重新登录后重试请求。
+
+// ErrSessionExpired 会话已失效
+var ErrSessionExpired = errors.New("session expired")
+
+// Login 任务的登录配置
+type Login struct {
+	URL    string            `json:"url"`    // 提交登录的地址
+	Method string            `json:"method"` // 提交登录的方法，默认 POST
+	JSON   bool              `json:"json"`   // 以 JSON 提交登录字段，否则以表单提交
+	Fields map[string]string `json:"fields"` // 登录字段，值中的 ${name} 替换为凭据 name
+
+	PageURL   string `json:"page_url"`   // 登录页地址，设置了 CSRF 时先访问该页面提取 token
+	CSRF      string `json:"csrf"`       // 提取 CSRF token 的正则表达式，第一个分组为 token
+	CSRFField string `json:"csrf_field"` // CSRF token 提交时的字段名
+
+	Success  string `json:"success"`   // 登录的响应需要匹配的正则表达式，为空时只要求状态码小于 400
+	CheckURL string `json:"check_url"` // 登录前先访问该地址，会话未失效时不再登录
+
+	ExpiredStatus []int  `json:"expired_status"` // 表示会话失效的状态码，例如 401
+	ExpiredURL    string `json:"expired_url"`    // 最终地址匹配该正则表达式时表示会话失效，例如被重定向到登录页
+	ExpiredMatch  string `json:"expired_match"`  // 响应内容匹配该正则表达式时表示会话失效
+
+	Credentials Credentials `json:"credentials"` // 凭据来源
+}
+
+// Enabled 是否需要登录
+func (l Login) Enabled() bool {
+	return l.URL != ""
+}
+
+// regexps 缓存编译后的正则表达式
+var regexps sync.Map
+
+func compile(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexps.Store(expr, re)
+	return re, nil
+}
+
+// match 正则表达式为空或无效时返回 false
+func match(expr string, b []byte) bool {
+	if expr == "" {
+		return false
+	}
+	re, err := compile(expr)
+	return err == nil && re.Match(b)
+}
+
+// Expired 响应是否表示会话已失效
+func (l Login) Expired(resp *Response) bool {
+	for _, code := range l.ExpiredStatus {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return match(l.ExpiredURL, []byte(resp.URL)) || match(l.ExpiredMatch, resp.Body)
+}
+
+// Credentials 凭据来源，环境变量优先于密钥文件。
+// 凭据 name 对应的环境变量为 EnvPrefix + 会话名 + "_" + name 或 EnvPrefix + name，全部大写，非字母数字的字符替换为 _；
+// 密钥文件为 JSON 对象，值可以是凭据，也可以是以会话名为键、包含该会话凭据的对象。
+type Credentials struct {
+	EnvPrefix string `json:"env_prefix"` // 环境变量前缀，例如 DOUBAN_
+	File      string `json:"file"`       // 密钥文件
+}
+
+// envName 返回环境变量名
+func envName(parts ...string) string {
+	name := strings.ToUpper(strings.Join(parts, ""))
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// Lookup 返回会话 session 的凭据 name
+func (c Credentials) Lookup(session, name string) (string, error) {
+	if v, ok := os.LookupEnv(envName(c.EnvPrefix, session, "_", name)); ok {
+		return v, nil
+	}
+	if v, ok := os.LookupEnv(envName(c.EnvPrefix, name)); ok {
+		return v, nil
+	}
+	if c.File != "" {
+		b, err := os.ReadFile(c.File)
+		if err != nil {
+			return "", err
+		}
+		var secrets map[string]interface{}
+		if err := json.Unmarshal(b, &secrets); err != nil {
+			return "", fmt.Errorf("read secrets %s: %w", c.File, err)
+		}
+		if m, ok := secrets[session].(map[string]interface{}); ok {
+			if v, ok := m[name].(string); ok {
+				return v, nil
+			}
+		}
+		if v, ok := secrets[name].(string); ok {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("missing credential %q for session %q", name, session)
+}
+
+// LoggedIn 访问 CheckURL 检查会话是否仍然有效，没有设置 CheckURL 时返回 false
+func (t *Task) LoggedIn(session string) (bool, error) {
+	if t.Login.CheckURL == "" {
+		return false, nil
+	}
+	resp, err := t.Fetcher.Get(&Request{Task: t, Url: t.Login.CheckURL, Session: session})
+	if err != nil {
+		return false, err
+	}
+	return resp.StatusCode < http.StatusBadRequest && !t.Login.Expired(resp), nil
+}
+
+// SignIn 使用会话 session 登录，登录后的 cookie 保存在会话中
+func (t *Task) SignIn(session string) error {
+	l := t.Login
+	fields := make(map[string]string, len(l.Fields)+1)
+	for k, v := range l.Fields {
+		var lookupErr error
+		fields[k] = os.Expand(v, func(name string) string {
+			cred, err := l.Credentials.Lookup(session, name)
+			if err != nil && lookupErr == nil {
+				lookupErr = err
+			}
+			return cred
+		})
+		if lookupErr != nil {
+			return lookupErr
+		}
+	}
+
+	if l.CSRF != "" {
+		token, err := t.csrfToken(session)
+		if err != nil {
+			return err
+		}
+		fields[l.CSRFField] = token
+	}
+
+	req := &Request{Task: t, Url: l.URL, Method: l.Method, Session: session}
+	if req.Method == "" {
+		req.Method = http.MethodPost
+	}
+	if l.JSON {
+		req.JSON = fields
+	} else {
+		req.Form = make(url.Values, len(fields))
+		for k, v := range fields {
+			req.Form.Set(k, v)
+		}
+	}
+	resp, err := t.Fetcher.Get(req)
+	if err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("login: %w", &StatusError{Code: resp.StatusCode})
+	}
+	if l.Success != "" && !match(l.Success, resp.Body) {
+		return errors.New("login: response does not match success pattern")
+	}
+	return nil
+}
+
+// csrfToken 从登录页中提取 CSRF token
+func (t *Task) csrfToken(session string) (string, error) {
+	page := t.Login.PageURL
+	if page == "" {
+		page = t.Login.URL
+	}
+	re, err := compile(t.Login.CSRF)
+	if err != nil {
+		return "", err
+	}
+	resp, err := t.Fetcher.Get(&Request{Task: t, Url: page, Session: session})
+	if err != nil {
+		return "", fmt.Errorf("login page: %w", err)
+	}
+	m := re.FindSubmatch(resp.Body)
+	if len(m) < 2 {
+		return "", errors.New("login page: csrf token not found")
+	}
+	return string(m[1]), nil
+}
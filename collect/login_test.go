@@ -0,0 +1,83 @@
+package collect_test
+
+import (
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/session"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentials(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secrets.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"username": "shared", "account1": {"password": "p1"}}`), 0600))
+	t.Setenv("DOUBAN_ACCOUNT2_PASSWORD", "p2")
+
+	c := collect.Credentials{EnvPrefix: "DOUBAN_", File: file}
+	v, err := c.Lookup("account1", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "p1", v)
+	v, err = c.Lookup("account2", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "p2", v)
+	v, err = c.Lookup("account2", "username")
+	require.NoError(t, err)
+	assert.Equal(t, "shared", v)
+	_, err = c.Lookup("account3", "password")
+	assert.Error(t, err)
+}
+
+func TestSignIn(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`<form><input name="ck" value="token1"></form>`))
+			return
+		}
+		if r.FormValue("ck") != "token1" || r.FormValue("name") != "nico" || r.FormValue("password") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "dbcl2", Value: "logged", Path: "/"})
+		_, _ = w.Write([]byte("welcome"))
+	})
+	mux.HandleFunc("/mine", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("dbcl2"); err != nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("mine"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	t.Setenv("TEST_PASSWORD", "secret")
+	pool, err := session.NewPool("test", session.Options{})
+	require.NoError(t, err)
+	task := &collect.Task{Property: collect.Property{
+		Login: collect.Login{
+			URL:           srv.URL + "/login",
+			Fields:        map[string]string{"name": "nico", "password": "${password}"},
+			CSRF:          `name="ck" value="([^"]+)"`,
+			CSRFField:     "ck",
+			Success:       "welcome",
+			CheckURL:      srv.URL + "/mine",
+			ExpiredURL:    "/login",
+			ExpiredStatus: []int{http.StatusUnauthorized},
+			Credentials:   collect.Credentials{EnvPrefix: "TEST_"},
+		},
+	}, Fetcher: collect.BaseFetch{}, Sessions: pool}
+
+	ok, err := task.LoggedIn(session.DefaultName)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, task.SignIn(session.DefaultName))
+	ok, err = task.LoggedIn(session.DefaultName)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
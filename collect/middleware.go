@@ -0,0 +1,156 @@
+package collect
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 中间件
+// 中间件在抓取前、抓取后和解析后处理请求，用于编写请求头注入、封禁检测、URL 过滤等通用逻辑。
+// 引擎的中间件先于任务的中间件执行，任一钩子返回错误时停止后续的中间件：
+// 返回 ErrSkip 时跳过请求，返回 ErrRetry 时按任务的重试策略重试，返回其他错误时视为请求失败。
+
+var (
+	ErrSkip  = errors.New("skip request")
+	ErrRetry = errors.New("retry request")
+)
+
+// Middleware 请求处理中间件
+type Middleware interface {
+	// BeforeFetch 抓取前调用，可以修改请求
+	BeforeFetch(req *Request) error
+	// AfterFetch 响应校验通过后调用，可以检查或修改响应
+	AfterFetch(req *Request, resp *Response) error
+	// AfterParse 解析后调用，可以过滤新的请求和解析得到的数据
+	AfterParse(req *Request, result *ParseResult) error
+}
+
+// MiddlewareFuncs 由函数组成的中间件，为空的钩子不做处理
+type MiddlewareFuncs struct {
+	Before func(req *Request) error
+	After  func(req *Request, resp *Response) error
+	Parsed func(req *Request, result *ParseResult) error
+}
+
+func (m MiddlewareFuncs) BeforeFetch(req *Request) error {
+	if m.Before == nil {
+		return nil
+	}
+	return m.Before(req)
+}
+
+func (m MiddlewareFuncs) AfterFetch(req *Request, resp *Response) error {
+	if m.After == nil {
+		return nil
+	}
+	return m.After(req, resp)
+}
+
+func (m MiddlewareFuncs) AfterParse(req *Request, result *ParseResult) error {
+	if m.Parsed == nil {
+		return nil
+	}
+	return m.Parsed(req, result)
+}
+
+// Chain 按顺序执行的中间件
+type Chain []Middleware
+
+func (c Chain) BeforeFetch(req *Request) error {
+	for _, m := range c {
+		if err := m.BeforeFetch(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c Chain) AfterFetch(req *Request, resp *Response) error {
+	for _, m := range c {
+		if err := m.AfterFetch(req, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c Chain) AfterParse(req *Request, result *ParseResult) error {
+	for _, m := range c {
+		if err := m.AfterParse(req, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setHeader 将请求中额外的请求头设置到 h
+func (r *Request) setHeader(h http.Header) {
+	for k, vs := range r.Header {
+		h.Del(k)
+		for _, v := range vs {
+			h.Add(k, v)
+		}
+	}
+}
+
+// SetHeader 为所有请求设置请求头，不覆盖请求中已有的值
+func SetHeader(key, value string) Middleware {
+	return MiddlewareFuncs{Before: func(req *Request) error {
+		if req.Header == nil {
+			req.Header = make(http.Header)
+		}
+		if _, ok := req.Header[http.CanonicalHeaderKey(key)]; !ok {
+			req.Header.Set(key, value)
+		}
+		return nil
+	}}
+}
+
+// AllowDomains 只抓取指定域名及其子域名下的页面，其他请求被跳过，解析得到的其他请求被丢弃
+func AllowDomains(domains ...string) Middleware {
+	allow := func(rawurl string) bool {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(u.Hostname())
+		for _, d := range domains {
+			d = strings.ToLower(d)
+			if host == d || strings.HasSuffix(host, "."+d) {
+				return true
+			}
+		}
+		return false
+	}
+	return MiddlewareFuncs{
+		Before: func(req *Request) error {
+			if !allow(req.Url) {
+				return ErrSkip
+			}
+			return nil
+		},
+		Parsed: func(req *Request, result *ParseResult) error {
+			reqs := result.Requesrts[:0]
+			for _, r := range result.Requesrts {
+				if allow(r.Url) {
+					reqs = append(reqs, r)
+				}
+			}
+			result.Requesrts = reqs
+			return nil
+		},
+	}
+}
+
+// RetryOn 校验器 v 失败时重试请求，例如页面内容提示稍后再试
+func RetryOn(v Validator) Middleware {
+	return MiddlewareFuncs{After: func(req *Request, resp *Response) error {
+		if err := v.Validate(resp); err != nil {
+			return fmt.Errorf("%w: %v", ErrRetry, err)
+		}
+		return nil
+	}}
+}
@@ -14,4 +14,5 @@ type RuleTree struct {
 type Rule struct {
 	ItemFields []string
 	ParseFunc  func(*Context) (ParseResult, error) // 内容解析函数
+	Validators []Validator                         // 响应校验器，在任务的校验器之后执行
 }
@@ -6,11 +6,14 @@ import (
 	"encoding/hex"
 	"errors"
 	"github.com/nico612/crawler-go/limiter"
+	"github.com/nico612/crawler-go/pipeline"
+	"github.com/nico612/crawler-go/session"
 	"github.com/nico612/crawler-go/storage"
 	"go.uber.org/zap"
 	"math/rand"
+	"net/http"
+	"net/url"
 	"regexp"
-	"sync"
 	"time"
 )
 
@@ -23,29 +26,158 @@ type Property struct {
 	WaitTime int64  `json:"wait_time"` // 随机休眠时间，秒
 	Reload   bool   `json:"reload"`    // 网站是否可以重复爬取
 	MaxDepth int64  `json:"max_depth"`
+
+	Retry        RetryPolicy `json:"retry"`         // 失败请求的重试策略
+	AcceptStatus []int       `json:"accept_status"` // 视为成功的状态码，为空时接受 2xx
+
+	Cron    string `json:"cron"`    // 周期执行的 cron 表达式，为空时只执行一次
+	Overlap string `json:"overlap"` // 触发时上一次运行还未结束的处理方式，默认 OverlapSkip
+
+	Incremental   bool `json:"incremental"`    // 记录页面状态并发送条件请求，页面未变化时不再解析
+	SkipUnchanged bool `json:"skip_unchanged"` // 开启增量抓取时，内容与上次相同的页面也不再解析
+
+	Canonical CanonicalOptions `json:"canonical"` // 计算请求唯一识别码时的 URL 规范化选项
+
+	OrderedResults bool `json:"ordered_results"` // 解析结果按交付顺序依次处理，不并发储存
+
+	Strategy string `json:"strategy"` // 相同优先级的请求的遍历策略，默认先进先出
+
+	Budget Budget `json:"budget"` // 每次运行的预算
+
+	StatusPolicy string `json:"status_policy"` // 状态码不符合要求时的处理方式，默认 StatusFail
+
+	Session session.Options `json:"session"` // 会话配置，配置后请求使用会话中的 cookie，并记录响应设置的 cookie
+	Login   Login           `json:"login"`   // 登录配置，任务开始前使用每个会话登录
 }
 
+// 状态码处理方式
+const (
+	StatusFail  = "fail"  // 按失败处理，根据重试策略重试
+	StatusSkip  = "skip"  // 跳过请求，不重试也不放入死信队列
+	StatusParse = "parse" // 不校验状态码，交给解析函数根据 Context.Resp 处理
+)
+
+// 遍历策略
+const (
+	StrategyFIFO      = ""     // 先进先出
+	StrategyBFS       = "bfs"  // 广度优先，深度小的请求先处理
+	StrategyDFS       = "dfs"  // 深度优先，深度大的请求先处理，相同深度后进先出，先完成一个分支
+	StrategyBestFirst = "best" // 最佳优先，Task.Score 得分高的请求先处理
+)
+
+const (
+	OverlapSkip  = "skip"  // 跳过本次触发
+	OverlapQueue = "queue" // 上一次运行结束后立即开始，多次触发只保留一次
+)
+
 // Task 爬虫一个任务实例
 type Task struct {
 	Property
-	Visited     map[string]bool // 是否访问过
-	VisitedLock sync.Mutex
-	Fetcher     Fetcher         // 请求处理
-	Storage     storage.Storage // 储存
-	Rule        RuleTree        // 规则条件中 Root 生成了初始化的爬虫任务。Trunk 为爬虫任务中的所有规则。
-	Logger      *zap.Logger
-	Limit       limiter.RateLimiter
+	Fetcher Fetcher         // 请求处理
+	Storage storage.Storage // 储存
+	Rule    RuleTree        // 规则条件中 Root 生成了初始化的爬虫任务。Trunk 为爬虫任务中的所有规则。
+	Logger  *zap.Logger
+	Limit   limiter.RateLimiter
+
+	Validators []Validator // 响应校验器，为空时只要求响应内容不为空
+
+	Middlewares []Middleware       // 任务的中间件，在引擎的中间件之后执行
+	Pipeline    *pipeline.Pipeline // 任务的数据处理管道，在引擎的管道之后执行
+
+	// Score 最佳优先策略下请求的得分，请求入队时计算一次
+	Score func(r *Request) float64
+
+	// Fingerprint 自定义请求的唯一识别码，为空时使用规范化后的 URL、Method、请求头和请求体计算
+	Fingerprint func(r *Request) string
+
+	RunID string    // 周期任务每次运行的标识，由引擎设置，请求按运行分别去重
+	Cache PageCache // 增量抓取的页面状态，由引擎设置
+
+	Sessions *session.Pool // 任务的会话，配置了 Session 时由引擎创建，同一个任务的多次运行共用
 }
 
 type Request struct {
 	unique   string
 	Task     *Task
-	Url      string // 请求url
-	Method   string
-	Depth    int64  // 爬取深度，默认为0
-	Priority int64  // 优先级
-	RuleName string // 规则名
-	TmpData  *Temp  // 临时数据缓存
+	Url      string        // 请求url
+	Method   string        // 请求方法，为空时有请求体的请求使用 POST，否则使用 GET
+	Query    url.Values    // 查询参数，合并到 Url 中
+	Header   http.Header   // 额外的请求头，覆盖抓取器设置的同名请求头
+	Form     url.Values    // 表单请求体
+	JSON     interface{}   // JSON 请求体
+	Body     []byte        // 原始请求体，需要在 Header 中设置 Content-Type
+	Timeout  time.Duration // 单个请求的超时时间，为 0 时使用抓取器的设置
+	Session  string        // 使用的会话名，为空时轮流选择一个会话
+	Depth    int64         // 爬取深度，默认为0
+	Priority int64         // 优先级
+	RuleName string        // 规则名
+	TmpData  *Temp         // 临时数据缓存
+	Retry    int           // 已重试次数
+}
+
+// RequestRecord 请求的可序列化形式，用于持久化储存请求。
+// 任务只记录名称，恢复时需要根据名称重新找到对应的任务。
+type RequestRecord struct {
+	TaskName string        `json:"task_name"`
+	Url      string        `json:"url"`
+	Method   string        `json:"method"`
+	Query    url.Values    `json:"query,omitempty"`
+	Header   http.Header   `json:"header,omitempty"`
+	Form     url.Values    `json:"form,omitempty"`
+	JSON     interface{}   `json:"json,omitempty"`
+	Body     []byte        `json:"body,omitempty"`
+	Timeout  time.Duration `json:"timeout,omitempty"`
+	Session  string        `json:"session,omitempty"`
+	Depth    int64         `json:"depth"`
+	Priority int64         `json:"priority"`
+	RuleName string        `json:"rule_name"`
+	TmpData  *Temp         `json:"tmp_data,omitempty"`
+	Retry    int           `json:"retry,omitempty"`
+}
+
+// Record 返回请求的可序列化形式
+func (r *Request) Record() RequestRecord {
+	rec := RequestRecord{
+		Url:      r.Url,
+		Method:   r.Method,
+		Query:    r.Query,
+		Header:   r.Header,
+		Form:     r.Form,
+		JSON:     r.JSON,
+		Body:     r.Body,
+		Timeout:  r.Timeout,
+		Session:  r.Session,
+		Depth:    r.Depth,
+		Priority: r.Priority,
+		RuleName: r.RuleName,
+		TmpData:  r.TmpData,
+		Retry:    r.Retry,
+	}
+	if r.Task != nil {
+		rec.TaskName = r.Task.Name
+	}
+	return rec
+}
+
+// Request 将记录还原为属于 task 的请求
+func (rec RequestRecord) Request(task *Task) *Request {
+	return &Request{
+		Task:     task,
+		Url:      rec.Url,
+		Method:   rec.Method,
+		Query:    rec.Query,
+		Header:   rec.Header,
+		Form:     rec.Form,
+		JSON:     rec.JSON,
+		Body:     rec.Body,
+		Timeout:  rec.Timeout,
+		Session:  rec.Session,
+		Depth:    rec.Depth,
+		Priority: rec.Priority,
+		RuleName: rec.RuleName,
+		TmpData:  rec.TmpData,
+		Retry:    rec.Retry,
+	}
 }
 
 // ParseResult 解析结果包含了需要进一步获取数据的 Requesrts 和 本次获取到的结果 Items
@@ -61,26 +193,80 @@ func (r *Request) Check() error {
 	return nil
 }
 
-// Unique 请求的唯一识别码
+// Validate 校验响应，依次检查状态码、任务的校验器和规则的校验器，StatusParse 策略下不检查状态码
+func (r *Request) Validate(resp *Response) error {
+	if r.Task.StatusPolicy != StatusParse {
+		if err := checkStatus(resp, r.Task.AcceptStatus); err != nil {
+			return err
+		}
+	}
+	validators := r.Task.Validators
+	if rule := r.Task.Rule.Trunk[r.RuleName]; rule != nil {
+		validators = append(validators[:len(validators):len(validators)], rule.Validators...)
+	}
+	if len(validators) == 0 {
+		validators = []Validator{MinSize(1)}
+	}
+	return Validate(resp, validators...)
+}
+
+// Unique 请求的唯一识别码，计算后缓存在请求中
 func (r *Request) Unique() string {
-	block := md5.Sum([]byte(r.Url + r.Method))
-	return hex.EncodeToString(block[:])
+	if r.unique != "" {
+		return r.unique
+	}
+	if r.Task != nil && r.Task.Fingerprint != nil {
+		r.unique = r.Task.Fingerprint(r)
+		return r.unique
+	}
+	u, method := r.FullURL(), r.Method
+	if r.Task != nil && r.Task.Canonical.enabled() {
+		u = Canonicalize(u, r.Task.Canonical)
+		method = r.HTTPMethod()
+	}
+	block := md5.Sum([]byte(u + method + r.fingerprint()))
+	r.unique = hex.EncodeToString(block[:])
+	return r.unique
 }
 
 // Fetch 请求数据
-func (r *Request) Fetch() ([]byte, error) {
-	if err := r.Task.Limit.Wait(context.Background()); err != nil {
+func (r *Request) Fetch() (*Response, error) {
+	if err := r.Wait(); err != nil {
 		return nil, err
 	}
-	// 随机休眠，模拟人类行为
-	sleeptime := rand.Int63n(r.Task.WaitTime * 1000)
-	time.Sleep(time.Duration(sleeptime) * time.Millisecond)
 	return r.Task.Fetcher.Get(r)
 }
 
+// Wait 等待限速器的令牌，并随机休眠
+func (r *Request) Wait() error {
+	if err := r.WaitLimit(); err != nil {
+		return err
+	}
+	r.Sleep()
+	return nil
+}
+
+// WaitLimit 等待任务的限速器的令牌
+func (r *Request) WaitLimit() error {
+	if r.Task.Limit == nil {
+		return nil
+	}
+	return r.Task.Limit.Wait(context.Background())
+}
+
+// Sleep 随机休眠，模拟人类行为
+func (r *Request) Sleep() {
+	if r.Task.WaitTime > 0 {
+		sleeptime := rand.Int63n(r.Task.WaitTime * 1000)
+		time.Sleep(time.Duration(sleeptime) * time.Millisecond)
+	}
+}
+
+// Context 解析时的上下文，JS 规则中通过 ctx 访问
 type Context struct {
-	Body []byte
-	Req  *Request
+	Body []byte    // 响应内容，与 Resp.Body 相同
+	Req  *Request  // 请求
+	Resp *Response // 响应，包括状态码、响应头、最终地址等
 }
 
 // GetRule 获取采集规则
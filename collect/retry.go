@@ -0,0 +1,111 @@
+package collect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// StatusError 响应状态码不是 2xx 时返回的错误
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.Code)
+}
+
+// RetryPolicy 失败请求的重试策略
+type RetryPolicy struct {
+	MaxAttempts int                  `json:"max_attempts"` // 最多尝试次数，包含第一次请求
+	BaseDelay   time.Duration        `json:"base_delay"`   // 第一次重试前的等待时间，之后每次翻倍
+	MaxDelay    time.Duration        `json:"max_delay"`    // 最长等待时间
+	BanDelay    time.Duration        `json:"ban_delay"`    // 被封禁后第一次重试前的等待时间，之后每次翻倍，不受 MaxDelay 限制
+	Jitter      float64              `json:"jitter"`       // 等待时间的随机抖动比例，0~1
+	RetryStatus []int                `json:"retry_status"` // 可以重试的状态码
+	Retryable   func(err error) bool `json:"-"`            // 自定义哪些错误可以重试，设置后忽略 RetryStatus
+}
+
+// DefaultRetryPolicy 未配置重试策略的任务使用的默认策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 2,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Minute,
+	BanDelay:    5 * time.Minute,
+	Jitter:      0.2,
+	RetryStatus: []int{429, 500, 502, 503, 504},
+}
+
+// WithDefaults 返回补全了默认值的策略
+func (p RetryPolicy) WithDefaults() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.BaseDelay == 0 {
+		p.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay == 0 {
+		p.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	if p.BanDelay == 0 {
+		p.BanDelay = DefaultRetryPolicy.BanDelay
+	}
+	if p.RetryStatus == nil {
+		p.RetryStatus = DefaultRetryPolicy.RetryStatus
+	}
+	return p
+}
+
+// ShouldRetry 判断第 attempt 次请求失败后是否还可以重试
+func (p RetryPolicy) ShouldRetry(err error, attempt int) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrRetry) {
+		return true
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		for _, code := range p.RetryStatus {
+			if code == se.Code {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Backoff 返回第 attempt 次请求失败后，重试前需要等待的时间
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	return p.jitter(d)
+}
+
+// Delay 返回第 attempt 次请求因 err 失败后，重试前需要等待的时间。
+// 被封禁时立即重试只会让封禁更严重，按 BanDelay 等待更长的时间
+func (p RetryPolicy) Delay(err error, attempt int) time.Duration {
+	if FailureKindOf(err) != FailureBanned {
+		return p.Backoff(attempt)
+	}
+	return p.jitter(float64(p.BanDelay) * math.Pow(2, float64(attempt-1)))
+}
+
+func (p RetryPolicy) jitter(d float64) time.Duration {
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
@@ -1,5 +1,7 @@
 package collect
 
+import "encoding/json"
+
 // Temp 临时数据缓存
 type Temp struct {
 	data map[string]interface{}
@@ -17,3 +19,12 @@ func (t *Temp) Set(key string, value interface{}) error {
 	t.data[key] = value
 	return nil
 }
+
+// MarshalJSON 序列化临时数据，用于持久化请求
+func (t *Temp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.data)
+}
+
+func (t *Temp) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &t.data)
+}
@@ -0,0 +1,192 @@
+package collect
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// 响应校验
+// 请求成功返回并不代表拿到了想要的内容，目标网站可能返回空页面、反爬验证页面等。
+// 任务和规则可以配置多个校验器，任意一个校验失败时请求按失败处理，并根据失败的分类决定后续的处理。
+
+// FailureKind 请求失败的分类
+type FailureKind string
+
+const (
+	FailureFetch   FailureKind = "fetch"   // 网络请求失败
+	FailureStatus  FailureKind = "status"  // 状态码不符合要求
+	FailureInvalid FailureKind = "invalid" // 内容不符合要求
+	FailureBanned  FailureKind = "banned"  // 被目标网站封禁，例如返回了反爬验证页面
+)
+
+// ValidationError 响应校验失败的错误
+type ValidationError struct {
+	Kind   FailureKind
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Reason)
+}
+
+// FailureKindOf 返回错误对应的失败分类
+func FailureKindOf(err error) FailureKind {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		return ve.Kind
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return FailureStatus
+	}
+	return FailureFetch
+}
+
+// Validator 响应校验器，返回错误表示校验失败
+type Validator interface {
+	Validate(resp *Response) error
+}
+
+// ValidatorFunc 使用函数实现自定义的校验器
+type ValidatorFunc func(resp *Response) error
+
+func (f ValidatorFunc) Validate(resp *Response) error {
+	return f(resp)
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &ValidationError{Kind: FailureInvalid, Reason: fmt.Sprintf(format, args...)}
+}
+
+// MinSize 响应内容至少 n 字节
+func MinSize(n int) Validator {
+	return ValidatorFunc(func(resp *Response) error {
+		if len(resp.Body) < n {
+			return invalid("body too short: %d < %d", len(resp.Body), n)
+		}
+		return nil
+	})
+}
+
+// MaxSize 响应内容最多 n 字节
+func MaxSize(n int) Validator {
+	return ValidatorFunc(func(resp *Response) error {
+		if len(resp.Body) > n {
+			return invalid("body too large: %d > %d", len(resp.Body), n)
+		}
+		return nil
+	})
+}
+
+// StatusIn 状态码必须是 codes 中的一个
+func StatusIn(codes ...int) Validator {
+	return ValidatorFunc(func(resp *Response) error {
+		for _, code := range codes {
+			if resp.StatusCode == code {
+				return nil
+			}
+		}
+		return &StatusError{Code: resp.StatusCode}
+	})
+}
+
+// Contains 响应内容必须包含 s
+func Contains(s string) Validator {
+	return ValidatorFunc(func(resp *Response) error {
+		if !bytes.Contains(resp.Body, []byte(s)) {
+			return invalid("body does not contain %q", s)
+		}
+		return nil
+	})
+}
+
+// NotContains 响应内容不能包含 s
+func NotContains(s string) Validator {
+	return ValidatorFunc(func(resp *Response) error {
+		if bytes.Contains(resp.Body, []byte(s)) {
+			return invalid("body contains %q", s)
+		}
+		return nil
+	})
+}
+
+// Match 响应内容必须匹配正则表达式 expr
+func Match(expr string) Validator {
+	re := regexp.MustCompile(expr)
+	return ValidatorFunc(func(resp *Response) error {
+		if !re.Match(resp.Body) {
+			return invalid("body does not match %q", expr)
+		}
+		return nil
+	})
+}
+
+// NotMatch 响应内容不能匹配正则表达式 expr
+func NotMatch(expr string) Validator {
+	re := regexp.MustCompile(expr)
+	return ValidatorFunc(func(resp *Response) error {
+		if re.Match(resp.Body) {
+			return invalid("body matches %q", expr)
+		}
+		return nil
+	})
+}
+
+// ContentType 响应的媒体类型必须是 types 中的一个，例如 text/html、application/json
+func ContentType(types ...string) Validator {
+	return ValidatorFunc(func(resp *Response) error {
+		ct := resp.Header.Get("Content-Type")
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			mt = strings.ToLower(strings.TrimSpace(ct))
+		}
+		for _, t := range types {
+			if strings.EqualFold(mt, t) {
+				return nil
+			}
+		}
+		return invalid("unexpected content type %q", ct)
+	})
+}
+
+// Classify 将校验器 v 的失败归为 kind 类
+func Classify(kind FailureKind, v Validator) Validator {
+	return ValidatorFunc(func(resp *Response) error {
+		err := v.Validate(resp)
+		if err == nil {
+			return nil
+		}
+		return &ValidationError{Kind: kind, Reason: err.Error()}
+	})
+}
+
+// Banned 校验器 v 失败时表示被目标网站封禁
+func Banned(v Validator) Validator {
+	return Classify(FailureBanned, v)
+}
+
+// Validate 依次执行校验器，返回第一个失败的错误
+func Validate(resp *Response, validators ...Validator) error {
+	for _, v := range validators {
+		if err := v.Validate(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkStatus 状态码必须在 accept 中，accept 为空时要求 2xx
+func checkStatus(resp *Response, accept []int) error {
+	if len(accept) == 0 {
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			return &StatusError{Code: resp.StatusCode}
+		}
+		return nil
+	}
+	return StatusIn(accept...).Validate(resp)
+}
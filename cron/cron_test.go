@@ -0,0 +1,51 @@
+package cron_test
+
+import (
+	"github.com/nico612/crawler-go/cron"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	base := time.Date(2023, 11, 10, 8, 30, 15, 0, time.UTC) // 周五
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2023, 11, 10, 8, 45, 0, 0, time.UTC)},
+		{"0 */6 * * *", time.Date(2023, 11, 10, 12, 0, 0, 0, time.UTC)},
+		{"30 8 * * *", time.Date(2023, 11, 11, 8, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2023, 11, 10, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2023, 11, 12, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2023, 11, 10, 8, 31, 45, 0, time.UTC)},
+		// 日或周不限制时，只按另一个字段匹配
+		{"0 0 13 * */1", time.Date(2023, 11, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * ?", time.Date(2023, 11, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 */1 * 1", time.Date(2023, 11, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 ? * 1", time.Date(2023, 11, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1-31 * 1", time.Date(2023, 11, 13, 0, 0, 0, 0, time.UTC)},
+		// 日和周都有限制时满足其一即可
+		{"0 0 13 * 6", time.Date(2023, 11, 11, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		s, err := cron.Parse(c.spec)
+		require.NoError(t, err, c.spec)
+		assert.Equal(t, c.want, s.Next(base), c.spec)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "@every 1ms"} {
+		_, err := cron.Parse(spec)
+		assert.Error(t, err, spec)
+	}
+
+	s, err := cron.Parse("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, s.Next(time.Now()).IsZero())
+}
@@ -0,0 +1,150 @@
+package dedup
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// 可扩展布隆过滤器（Scalable Bloom Filter）
+// 普通的布隆过滤器需要预先确定容量，超出容量后误判率会迅速升高。
+// 可扩展布隆过滤器由多个容量依次增大的过滤器组成，当前过滤器写满后追加一个新的过滤器，
+// 新过滤器的误判率按 tighteningRatio 逐级收紧，使总的误判率不超过设定值。
+
+const (
+	growthFactor    = 2   // 新过滤器的容量倍数
+	tighteningRatio = 0.5 // 新过滤器的误判率收紧比例
+)
+
+// bloomFilter 单个布隆过滤器
+type bloomFilter struct {
+	bits     []uint64
+	m        uint64 // 位数
+	k        uint64 // 哈希函数个数
+	capacity uint64
+	count    uint64
+}
+
+func newBloomFilter(capacity uint64, fpRate float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m == 0 {
+		m = 1
+	}
+	k := uint64(math.Ceil(float64(m) / float64(capacity) * math.Ln2))
+	if k == 0 {
+		k = 1
+	}
+	return &bloomFilter{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        k,
+		capacity: capacity,
+	}
+}
+
+// location 使用两个哈希值模拟 k 个哈希函数
+func (f *bloomFilter) location(h1, h2 uint64, i uint64) uint64 {
+	return (h1 + i*h2) % f.m
+}
+
+func (f *bloomFilter) add(h1, h2 uint64) {
+	for i := uint64(0); i < f.k; i++ {
+		loc := f.location(h1, h2, i)
+		f.bits[loc/64] |= 1 << (loc % 64)
+	}
+	f.count++
+}
+
+func (f *bloomFilter) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < f.k; i++ {
+		loc := f.location(h1, h2, i)
+		if f.bits[loc/64]&(1<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func hashKey(key string) (uint64, uint64) {
+	a := fnv.New64a()
+	a.Write([]byte(key))
+	b := fnv.New64()
+	b.Write([]byte(key))
+	// h2 为奇数，保证与位数互质的概率更高
+	return a.Sum64(), b.Sum64() | 1
+}
+
+// BloomDeduper 基于可扩展布隆过滤器的去重器，存在一定的误判率：未记录的 key 可能被判定为已记录。
+// 布隆过滤器本身不支持删除，被删除的 key 记录在单独的集合中，通常只有失败等待重试的请求会被删除。
+type BloomDeduper struct {
+	mu       sync.RWMutex
+	filters  []*bloomFilter
+	capacity uint64
+	fpRate   float64
+	deleted  map[string]struct{}
+}
+
+// NewBloomDeduper 创建布隆过滤器去重器，capacity 为初始容量，fpRate 为总的误判率
+func NewBloomDeduper(capacity uint64, fpRate float64) *BloomDeduper {
+	if capacity == 0 {
+		capacity = 1024
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.001
+	}
+	d := &BloomDeduper{
+		capacity: capacity,
+		fpRate:   fpRate,
+		deleted:  make(map[string]struct{}),
+	}
+	// 各级误判率为 p0 * r^i，总和不超过 p0 / (1 - r)
+	d.filters = append(d.filters, newBloomFilter(capacity, fpRate*(1-tighteningRatio)))
+	return d
+}
+
+func (d *BloomDeduper) Has(key string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if _, ok := d.deleted[key]; ok {
+		return false
+	}
+	return d.test(hashKey(key))
+}
+
+func (d *BloomDeduper) test(h1, h2 uint64) bool {
+	for _, f := range d.filters {
+		if f.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *BloomDeduper) Add(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.deleted, key)
+
+	h1, h2 := hashKey(key)
+	if d.test(h1, h2) {
+		return nil
+	}
+	last := d.filters[len(d.filters)-1]
+	if last.count >= last.capacity {
+		n := len(d.filters)
+		last = newBloomFilter(
+			last.capacity*growthFactor,
+			d.fpRate*(1-tighteningRatio)*math.Pow(tighteningRatio, float64(n)),
+		)
+		d.filters = append(d.filters, last)
+	}
+	last.add(h1, h2)
+	return nil
+}
+
+func (d *BloomDeduper) Delete(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deleted[key] = struct{}{}
+	return nil
+}
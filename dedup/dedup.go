@@ -0,0 +1,52 @@
+package dedup
+
+import (
+	"sync"
+)
+
+// 请求去重
+// 爬虫需要记录已经访问过的请求，避免重复抓取。千万级别的请求如果全部储存在 map 中会占用大量内存，
+// 因此提供了多种实现：内存 map、可扩展的布隆过滤器以及将记录持久化到文件中的实现。
+
+// Deduper 去重器接口，实现需要保证并发安全
+type Deduper interface {
+	// Has 判断 key 是否已经记录
+	Has(key string) bool
+	// Add 记录 key
+	Add(key string) error
+	// Delete 删除 key，删除后 Has 返回 false
+	Delete(key string) error
+}
+
+// MapDeduper 基于 map 的去重器
+type MapDeduper struct {
+	mu   sync.RWMutex
+	keys map[string]struct{}
+}
+
+func NewMapDeduper() *MapDeduper {
+	return &MapDeduper{
+		keys: make(map[string]struct{}),
+	}
+}
+
+func (d *MapDeduper) Has(key string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, ok := d.keys[key]
+	return ok
+}
+
+func (d *MapDeduper) Add(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys[key] = struct{}{}
+	return nil
+}
+
+func (d *MapDeduper) Delete(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.keys, key)
+	return nil
+}
@@ -0,0 +1,60 @@
+package dedup_test
+
+import (
+	"fmt"
+	"github.com/nico612/crawler-go/dedup"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomDeduper(t *testing.T) {
+	const count = 20000
+	d := dedup.NewBloomDeduper(1000, 0.01)
+	for i := 0; i < count; i++ {
+		require.NoError(t, d.Add(fmt.Sprintf("visited-%d", i)))
+	}
+	for i := 0; i < count; i++ {
+		require.True(t, d.Has(fmt.Sprintf("visited-%d", i)))
+	}
+
+	var falsePositive int
+	for i := 0; i < count; i++ {
+		if d.Has(fmt.Sprintf("unknown-%d", i)) {
+			falsePositive++
+		}
+	}
+	assert.Less(t, float64(falsePositive)/count, 0.02)
+
+	require.NoError(t, d.Delete("visited-1"))
+	assert.False(t, d.Has("visited-1"))
+	require.NoError(t, d.Add("visited-1"))
+	assert.True(t, d.Has("visited-1"))
+}
+
+func TestFileDeduper(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "visited.log")
+	d, err := dedup.NewFileDeduper(path, dedup.NewMapDeduper())
+	require.NoError(t, err)
+	require.NoError(t, d.Add("a"))
+	require.NoError(t, d.Add("b"))
+	require.NoError(t, d.Delete("a"))
+	require.NoError(t, d.Add("c"))
+	require.NoError(t, d.Delete("c"))
+	require.NoError(t, d.Add("c"))
+	require.NoError(t, d.Close())
+
+	d, err = dedup.NewFileDeduper(path, dedup.NewBloomDeduper(100, 0.01))
+	require.NoError(t, err)
+	defer d.Close()
+	assert.False(t, d.Has("a"))
+	assert.True(t, d.Has("b"))
+	assert.True(t, d.Has("c"))
+	// 打开时压缩，只保留仍然有效的记录
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "+b\n+c\n", string(b))
+}
@@ -0,0 +1,147 @@
+package dedup
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileDeduper 将记录追加写入文件的去重器，启动时回放文件恢复记录，实际的判断由内部的 Deduper 完成。
+// 与 BloomDeduper 组合使用可以同时获得较低的内存占用和重启后的持久化。
+// 运行期间文件只追加，每次打开时压缩，只保留仍然有效的记录，文件大小不会随运行次数无限增长。
+type FileDeduper struct {
+	Deduper
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileDeduper 打开 path 对应的记录文件，将其中的记录恢复到 inner 中
+func NewFileDeduper(path string, inner Deduper) (*FileDeduper, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	keys, err := replay(path, inner)
+	if err != nil {
+		return nil, err
+	}
+	if err := compact(path, keys); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileDeduper{
+		Deduper: inner,
+		file:    f,
+	}, nil
+}
+
+// replay 回放记录文件，每行第一个字符表示操作：+ 记录，- 删除。
+// 按第一次记录的顺序返回没有被删除的记录
+func replay(path string, d Deduper) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var order []string
+	live := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < 2 {
+			continue
+		}
+		key := line[1:]
+		switch line[0] {
+		case '+':
+			err = d.Add(key)
+			if _, ok := live[key]; !ok {
+				order = append(order, key)
+			}
+			live[key] = true
+		case '-':
+			err = d.Delete(key)
+			live[key] = false
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	keys := order[:0]
+	for _, key := range order {
+		if live[key] {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// compact 将记录重写到新文件中替换原来的文件，去掉已删除和重复的记录
+func compact(path string, keys []string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, key := range keys {
+		if _, err := w.WriteString("+" + key + "\n"); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (d *FileDeduper) write(op byte, key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err := d.file.WriteString(string(op) + key + "\n")
+	return err
+}
+
+func (d *FileDeduper) Add(key string) error {
+	if err := d.Deduper.Add(key); err != nil {
+		return err
+	}
+	return d.write('+', key)
+}
+
+func (d *FileDeduper) Delete(key string) error {
+	if err := d.Deduper.Delete(key); err != nil {
+		return err
+	}
+	return d.write('-', key)
+}
+
+// Close 关闭记录文件
+func (d *FileDeduper) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.file.Sync(); err != nil {
+		d.file.Close()
+		return err
+	}
+	return d.file.Close()
+}
@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"context"
+	"github.com/nico612/crawler-go/collect"
+	"go.uber.org/zap"
+	"sync/atomic"
+	"time"
+)
+
+// 自适应 worker 数量
+// 设置了 MaxWorkers 时，引擎每隔 AdaptInterval 根据这段时间内的抓取情况调整 worker 数量：
+// 1. 错误率过高、抓取延迟明显变大，说明网站压力过大或开始封禁，减少 worker；
+// 2. 等待限速器的时间超过抓取本身的时间，增加 worker 也无法加快抓取，减少 worker；
+// 3. 等待处理的请求多于 worker 数时增加 worker，没有等待的请求且大部分 worker 空闲时减少 worker。
+
+const (
+	adaptErrorRate     = 0.2 // 错误率超过该值时减少 worker
+	adaptLatencyFactor = 2   // 平均延迟超过基准延迟的倍数时减少 worker
+)
+
+// fetchStats 一个调整周期内的抓取统计
+type fetchStats struct {
+	fetches int64
+	errors  int64
+	latency int64 // 抓取的总耗时，单位纳秒
+	wait    int64 // 等待限速器的总耗时，单位纳秒
+}
+
+// fetch 等待限速器并随机休眠后抓取，分别记录等待限速器和抓取的耗时，随机休眠不计入
+func (c *Crawler) fetch(req *collect.Request) (*collect.Response, error) {
+	start := time.Now()
+	err := req.WaitLimit()
+	atomic.AddInt64(&c.fetchStats.wait, int64(time.Since(start)))
+	if err != nil {
+		return nil, err
+	}
+	req.Sleep()
+	start = time.Now()
+	resp, err := req.Task.Fetcher.Get(req)
+	atomic.AddInt64(&c.fetchStats.fetches, 1)
+	atomic.AddInt64(&c.fetchStats.latency, int64(time.Since(start)))
+	if err != nil {
+		atomic.AddInt64(&c.fetchStats.errors, 1)
+	}
+	return resp, err
+}
+
+// fetchFailed 记录抓取后校验失败的请求
+func (c *Crawler) fetchFailed() {
+	atomic.AddInt64(&c.fetchStats.errors, 1)
+}
+
+// adapt 周期性地调整 worker 数量，ctx 取消后返回
+func (c *Crawler) adapt(ctx context.Context) {
+	ticker := time.NewTicker(c.AdaptInterval)
+	defer ticker.Stop()
+	var baseline time.Duration
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			baseline = c.adjustWorkers(baseline)
+		}
+	}
+}
+
+// adjustWorkers 根据上一个周期的统计调整 worker 数量，返回更新后的基准延迟
+func (c *Crawler) adjustWorkers(baseline time.Duration) time.Duration {
+	fetches := atomic.SwapInt64(&c.fetchStats.fetches, 0)
+	errs := atomic.SwapInt64(&c.fetchStats.errors, 0)
+	latency := time.Duration(atomic.SwapInt64(&c.fetchStats.latency, 0))
+	wait := time.Duration(atomic.SwapInt64(&c.fetchStats.wait, 0))
+
+	sample := adaptSample{
+		fetches:  fetches,
+		baseline: baseline,
+		backlog:  c.backlog(),
+		busy:     int(atomic.LoadInt64(&c.busy)),
+		workers:  int(c.WorkerStats().Target),
+	}
+	if fetches > 0 {
+		sample.errRate = float64(errs) / float64(fetches)
+		sample.latency = latency / time.Duration(fetches)
+		sample.wait = wait / time.Duration(fetches)
+	}
+	target, reason := sample.decide()
+	n := sample.workers
+
+	// 延迟正常时更新基准延迟
+	if fetches > 0 && (baseline == 0 || sample.latency <= adaptLatencyFactor*baseline) {
+		if baseline == 0 {
+			baseline = sample.latency
+		} else {
+			baseline = (baseline*4 + sample.latency) / 5
+		}
+	}
+
+	c.SetWorkerCount(target)
+	if stats := c.WorkerStats(); int(stats.Target) != n {
+		c.Logger.Info("adjust workers",
+			zap.Int("from", n),
+			zap.Int64("to", stats.Target),
+			zap.String("reason", reason),
+			zap.Int64("backlog", sample.backlog),
+			zap.Int("busy", sample.busy),
+			zap.Float64("error_rate", sample.errRate),
+			zap.Duration("latency", sample.latency),
+			zap.Duration("wait", sample.wait),
+		)
+	}
+	return baseline
+}
+
+// adaptSample 一个调整周期的抓取情况
+type adaptSample struct {
+	fetches  int64
+	errRate  float64
+	latency  time.Duration // 平均抓取延迟
+	wait     time.Duration // 平均等待限速器的时间
+	baseline time.Duration // 基准延迟
+	backlog  int64         // 等待 worker 处理的请求数
+	busy     int           // 正在处理请求的 worker 数
+	workers  int           // 当前的 worker 数
+}
+
+// decide 返回调整后的 worker 数和调整的原因，不需要调整时原因为空
+func (s adaptSample) decide() (int, string) {
+	n := s.workers
+	switch {
+	case s.fetches > 0 && s.errRate > adaptErrorRate:
+		return n - 1, "error_rate"
+	case s.fetches > 0 && s.wait > s.latency:
+		return n - 1, "limiter_wait"
+	case s.baseline > 0 && s.latency > adaptLatencyFactor*s.baseline:
+		return n - 1, "latency"
+	case s.backlog > int64(n):
+		step := n / 4
+		if step < 1 {
+			step = 1
+		}
+		return n + step, "queue_depth"
+	case s.backlog == 0 && s.busy < n/2:
+		return n - 1, "idle"
+	}
+	return n, ""
+}
+
+// backlog 返回等待 worker 处理的请求数，不包括正在处理、已暂存、等待重试和等待结果处理的请求
+func (c *Crawler) backlog() int64 {
+	c.taskLock.RLock()
+	var parked int64
+	for _, run := range c.runs {
+		parked += int64(len(run.parked))
+	}
+	c.taskLock.RUnlock()
+	n := c.tracker.pending() - parked - atomic.LoadInt64(&c.busy) - atomic.LoadInt64(&c.retrying) - int64(len(c.out))
+	for _, own := range c.outs {
+		n -= int64(len(own))
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"github.com/nico612/crawler-go/collect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptDecide(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample adaptSample
+		target int
+		reason string
+	}{
+		{"queue_depth", adaptSample{fetches: 10, latency: time.Second, backlog: 20, busy: 8, workers: 8}, 10, "queue_depth"},
+		{"queue_depth_small", adaptSample{backlog: 5, workers: 2}, 3, "queue_depth"},
+		{"error_rate", adaptSample{fetches: 10, errRate: 0.5, backlog: 20, workers: 8}, 7, "error_rate"},
+		{"limiter_wait", adaptSample{fetches: 10, latency: time.Second, wait: 2 * time.Second, backlog: 20, workers: 8}, 7, "limiter_wait"},
+		{"latency", adaptSample{fetches: 10, latency: 3 * time.Second, baseline: time.Second, backlog: 20, workers: 8}, 7, "latency"},
+		{"idle", adaptSample{fetches: 10, latency: time.Second, busy: 1, workers: 8}, 7, "idle"},
+		{"steady", adaptSample{fetches: 10, latency: time.Second, backlog: 4, busy: 8, workers: 8}, 8, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, reason := tt.sample.decide()
+			assert.Equal(t, tt.target, target)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
+
+func TestAdaptBounds(t *testing.T) {
+	c := NewEngine(WithAdaptiveWorkers(2, 4))
+	c.SetWorkerCount(10)
+	assert.EqualValues(t, 4, c.WorkerStats().Target)
+	c.SetWorkerCount(0)
+	assert.EqualValues(t, 2, c.WorkerStats().Target)
+}
+
+func TestAdaptBacklogExcludesRetrying(t *testing.T) {
+	c := NewEngine()
+	task := &collect.Task{Property: collect.Property{Name: "backlog"}}
+	c.tracker.add(&collect.Request{Task: task}, &collect.Request{Task: task}, &collect.Request{Task: task})
+	c.retrying = 1
+	assert.EqualValues(t, 2, c.backlog())
+}
+
+func TestFetchWaitExcludesSleep(t *testing.T) {
+	c := NewEngine()
+	task := &collect.Task{
+		Property: collect.Property{Name: "sleep", WaitTime: 1},
+		Fetcher:  fetcherFunc(func(*collect.Request) (*collect.Response, error) { return &collect.Response{}, nil }),
+	}
+	for i := 0; i < 2; i++ {
+		_, err := c.fetch(&collect.Request{Task: task})
+		assert.NoError(t, err)
+	}
+	// 随机休眠既不算等待限速器，也不算抓取
+	assert.Less(t, time.Duration(c.fetchStats.wait), 50*time.Millisecond)
+	assert.Less(t, time.Duration(c.fetchStats.latency), 50*time.Millisecond)
+}
+
+type fetcherFunc func(*collect.Request) (*collect.Response, error)
+
+func (f fetcherFunc) Get(req *collect.Request) (*collect.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"github.com/nico612/crawler-go/collect"
+	"go.uber.org/zap"
+	"time"
+)
+
+// 任务预算
+// 引擎记录每次运行抓取的页面数、下载的字节数和解析得到的数据条数，超出任务的预算时停止本次运行，
+// 正在处理的请求正常完成，剩余的请求在被取出时丢弃，停止原因记录在 TaskSummary.StopReason 中。
+// 单个域名的页面数超出预算时只跳过该域名的请求，其他域名的页面仍然有效，任务不停止，
+// 所有域名的请求处理完后任务正常结束，StopReason 记录为 max_pages_per_host。
+
+// 停止原因
+const (
+	StopMaxPages    = "max_pages"
+	StopMaxBytes    = "max_bytes"
+	StopMaxItems    = "max_items"
+	StopMaxDuration = "max_duration"
+	StopMaxPerHost  = "max_pages_per_host"
+)
+
+// budgetUsage 一次运行已经使用的预算
+type budgetUsage struct {
+	pages int64
+	bytes int64
+	items int64
+	hosts map[string]int64
+	timer *time.Timer
+}
+
+// currentRun 返回请求所属的运行，请求不属于任务最近一次的运行时返回 nil，需要持有 taskLock
+func (c *Crawler) currentRun(task *collect.Task) *taskRun {
+	run, ok := c.runs[task.Name]
+	if !ok || run.task != task {
+		return nil
+	}
+	return run
+}
+
+// startBudget 开始计算运行时间
+func (c *Crawler) startBudget(run *taskRun) {
+	d := run.task.Budget.MaxDuration
+	if d <= 0 {
+		return
+	}
+	timer := time.AfterFunc(d, func() {
+		c.taskLock.Lock()
+		parked := c.stopRun(run, StopMaxDuration)
+		c.taskLock.Unlock()
+		c.dropParked(parked)
+	})
+	c.taskLock.Lock()
+	run.usage.timer = timer
+	c.taskLock.Unlock()
+}
+
+// reserve 抓取前占用一个页面的预算，返回 false 表示请求需要跳过
+func (c *Crawler) reserve(req *collect.Request) bool {
+	budget := req.Task.Budget
+	if !budget.Enabled() {
+		return true
+	}
+	c.taskLock.Lock()
+	run := c.currentRun(req.Task)
+	if run == nil {
+		c.taskLock.Unlock()
+		return true
+	}
+	if run.state == TaskStopped {
+		c.taskLock.Unlock()
+		return false
+	}
+	if budget.MaxPagesPerHost > 0 {
+		host := requestHost(req)
+		if run.usage.hosts[host] >= budget.MaxPagesPerHost {
+			c.limitHost(run)
+			c.taskLock.Unlock()
+			c.Logger.Debug("host budget exceeded", zap.String("task", req.Task.Name), zap.String("host", host))
+			return false
+		}
+		if run.usage.hosts == nil {
+			run.usage.hosts = make(map[string]int64)
+		}
+		run.usage.hosts[host]++
+	}
+	run.usage.pages++
+	// 最后一个页面正常抓取，之后的请求被丢弃
+	var parked []*collect.Request
+	if budget.MaxPages > 0 && run.usage.pages >= budget.MaxPages {
+		parked = c.stopRun(run, StopMaxPages)
+	}
+	c.taskLock.Unlock()
+	c.dropParked(parked)
+	return true
+}
+
+// consume 记录下载的字节数和解析得到的数据条数
+func (c *Crawler) consume(task *collect.Task, bytes, items int) {
+	budget := task.Budget
+	if budget.MaxBytes <= 0 && budget.MaxItems <= 0 {
+		return
+	}
+	c.taskLock.Lock()
+	run := c.currentRun(task)
+	if run == nil {
+		c.taskLock.Unlock()
+		return
+	}
+	run.usage.bytes += int64(bytes)
+	run.usage.items += int64(items)
+	var parked []*collect.Request
+	switch {
+	case budget.MaxBytes > 0 && run.usage.bytes >= budget.MaxBytes:
+		parked = c.stopRun(run, StopMaxBytes)
+	case budget.MaxItems > 0 && run.usage.items >= budget.MaxItems:
+		parked = c.stopRun(run, StopMaxItems)
+	}
+	c.taskLock.Unlock()
+	c.dropParked(parked)
+}
+
+// limitHost 有域名超出预算时记录原因，任务继续运行，需要持有 taskLock
+func (c *Crawler) limitHost(run *taskRun) {
+	if run.stopReason != "" {
+		return
+	}
+	run.stopReason = StopMaxPerHost
+	c.tracker.update(run.task, func(s *TaskSummary) {
+		s.StopReason = StopMaxPerHost
+	})
+	c.Logger.Info("task host budget exceeded, skip requests of the host",
+		zap.String("task", run.task.Name),
+		zap.Int64("max_pages_per_host", run.task.Budget.MaxPagesPerHost),
+	)
+}
+
+// stopRun 因超出预算停止运行，返回需要丢弃的暂存请求，需要持有 taskLock
+func (c *Crawler) stopRun(run *taskRun, reason string) []*collect.Request {
+	if run.state != TaskRunning && run.state != TaskPaused {
+		return nil
+	}
+	run.state = TaskStopped
+	run.stopReason = reason
+	if run.usage.timer != nil {
+		run.usage.timer.Stop()
+	}
+	parked := run.parked
+	run.parked = nil
+	c.tracker.update(run.task, func(s *TaskSummary) {
+		s.StopReason = reason
+	})
+	c.Logger.Info("task budget exceeded",
+		zap.String("task", run.task.Name),
+		zap.String("reason", reason),
+		zap.Int64("pages", run.usage.pages),
+		zap.Int64("bytes", run.usage.bytes),
+		zap.Int64("items", run.usage.items),
+	)
+	return parked
+}
+
+// dropParked 丢弃暂存的请求
+func (c *Crawler) dropParked(parked []*collect.Request) {
+	for _, req := range parked {
+		c.finish(req, resultSkipped)
+	}
+}
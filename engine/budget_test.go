@@ -0,0 +1,71 @@
+package engine_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/dedup"
+	"github.com/nico612/crawler-go/engine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudgetSkipNotVisited(t *testing.T) {
+	deduper := dedup.NewMapDeduper()
+	task := listTask("budget", 10)
+	task.Budget = collect.Budget{MaxPagesPerHost: 3}
+	e := newTestEngine(&fakeFetcher{}, engine.NewSchedule(), []*collect.Task{task},
+		engine.WithWorkCount(1), engine.WithDeduper(deduper))
+	runEngine(t, e, 5*time.Second)
+
+	// 只有一个域名，超出预算后剩余的请求都被跳过，任务正常结束并记录原因
+	summary, _ := e.Summary("budget")
+	assert.True(t, summary.Done())
+	assert.EqualValues(t, 3, summary.Fetched)
+	assert.EqualValues(t, 8, summary.Skipped)
+	assert.Equal(t, engine.StopMaxPerHost, summary.StopReason)
+
+	// 因预算跳过的请求没有记录为已访问
+	var visited int
+	for i := 0; i < 10; i++ {
+		req := &collect.Request{Task: task, Url: fmt.Sprintf("http://budget/item/%d", i)}
+		if deduper.Has(req.Unique()) {
+			visited++
+		}
+	}
+	assert.Equal(t, 2, visited)
+}
+
+func TestBudgetPerHostKeepsOtherHosts(t *testing.T) {
+	f := &fakeFetcher{}
+	task := &collect.Task{
+		Property: collect.Property{Name: "hosts", MaxDepth: 5, Budget: collect.Budget{MaxPagesPerHost: 2}},
+		Rule: collect.RuleTree{
+			Root: func() ([]*collect.Request, error) {
+				var reqs []*collect.Request
+				for _, host := range []string{"a", "b"} {
+					for i := 0; i < 4; i++ {
+						reqs = append(reqs, &collect.Request{Url: fmt.Sprintf("http://%s/%d", host, i), RuleName: "page"})
+					}
+				}
+				return reqs, nil
+			},
+			Trunk: map[string]*collect.Rule{
+				"page": {ParseFunc: func(ctx *collect.Context) (collect.ParseResult, error) {
+					return collect.ParseResult{}, nil
+				}},
+			},
+		},
+	}
+	e := newTestEngine(f, engine.NewSchedule(), []*collect.Task{task}, engine.WithWorkCount(1))
+	runEngine(t, e, 5*time.Second)
+
+	// 一个域名超出预算不影响其他域名
+	summary, _ := e.Summary("hosts")
+	assert.EqualValues(t, 4, summary.Fetched)
+	assert.EqualValues(t, 4, summary.Skipped)
+	assert.Equal(t, engine.StopMaxPerHost, summary.StopReason)
+	status, _ := e.TaskStatus("hosts")
+	assert.NotEqual(t, engine.TaskStopped, status.State)
+}
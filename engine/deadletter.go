@@ -0,0 +1,194 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/nico612/crawler-go/collect"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 死信队列
+// 重试次数用尽后仍然失败的请求会被放入死信队列，可以查看、导出，并在问题解决后重新加入调度。
+
+// DeadLetter 永久失败的请求
+type DeadLetter struct {
+	ID       string                `json:"id"`
+	Request  collect.RequestRecord `json:"request"`
+	Err      string                `json:"err"`
+	Attempts int                   `json:"attempts"` // 总共尝试的次数
+	Time     time.Time             `json:"time"`
+}
+
+// DeadLetterStore 死信储存，实现需要保证并发安全
+type DeadLetterStore interface {
+	// Add 添加死信，ID 相同时覆盖
+	Add(d DeadLetter) error
+	// List 按添加顺序返回所有死信
+	List() ([]DeadLetter, error)
+	// Remove 删除死信
+	Remove(ids ...string) error
+}
+
+// MemoryDeadLetter 储存在内存中的死信队列
+type MemoryDeadLetter struct {
+	mu      sync.Mutex
+	letters map[string]DeadLetter
+	order   []string
+}
+
+func NewMemoryDeadLetter() *MemoryDeadLetter {
+	return &MemoryDeadLetter{
+		letters: make(map[string]DeadLetter),
+	}
+}
+
+func (m *MemoryDeadLetter) Add(d DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.letters[d.ID]; !ok {
+		m.order = append(m.order, d.ID)
+	}
+	m.letters[d.ID] = d
+	return nil
+}
+
+func (m *MemoryDeadLetter) List() ([]DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]DeadLetter, 0, len(m.order))
+	for _, id := range m.order {
+		list = append(list, m.letters[id])
+	}
+	return list, nil
+}
+
+func (m *MemoryDeadLetter) Remove(ids ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(ids...)
+	return nil
+}
+
+func (m *MemoryDeadLetter) remove(ids ...string) {
+	for _, id := range ids {
+		delete(m.letters, id)
+	}
+	order := m.order[:0]
+	for _, id := range m.order {
+		if _, ok := m.letters[id]; ok {
+			order = append(order, id)
+		}
+	}
+	m.order = order
+}
+
+// FileDeadLetter 持久化到文件的死信队列，文件每行一条 JSON 格式的死信
+type FileDeadLetter struct {
+	MemoryDeadLetter
+	path string
+	file *os.File
+}
+
+// NewFileDeadLetter 打开 path 对应的死信文件并加载已有的死信
+func NewFileDeadLetter(path string) (*FileDeadLetter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f := &FileDeadLetter{
+		MemoryDeadLetter: MemoryDeadLetter{letters: make(map[string]DeadLetter)},
+		path:             path,
+	}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	if err := f.rewrite(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileDeadLetter) load() error {
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var d DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			continue
+		}
+		f.MemoryDeadLetter.Add(d)
+	}
+	return scanner.Err()
+}
+
+// rewrite 将内存中的死信重新写入文件
+func (f *FileDeadLetter) rewrite() error {
+	tmp := f.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, id := range f.order {
+		if err := enc.Encode(f.letters[id]); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+	if err := os.Rename(tmp, f.path); err != nil {
+		return err
+	}
+
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file, err = os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	return err
+}
+
+func (f *FileDeadLetter) Add(d DeadLetter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.letters[d.ID]; !ok {
+		f.order = append(f.order, d.ID)
+	}
+	f.letters[d.ID] = d
+	// 相同 ID 的旧记录在加载时会被后面的记录覆盖
+	return json.NewEncoder(f.file).Encode(d)
+}
+
+func (f *FileDeadLetter) Remove(ids ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.remove(ids...)
+	return f.rewrite()
+}
+
+// Close 关闭死信文件
+func (f *FileDeadLetter) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
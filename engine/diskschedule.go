@@ -0,0 +1,296 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/nico612/crawler-go/collect"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// 持久化调度器
+// 爬虫任务可能持续数天，进程重启后内存中的任务队列会全部丢失。
+// DiskSchedule 将推入的请求和处理结束的请求以追加日志的方式写入磁盘，重启时按推入的顺序恢复尚未处理结束的请求，
+// 包括正在处理、等待重试和暂停任务暂存的请求。
+
+const (
+	diskLogName         = "requests.log"
+	diskCompactInterval = 10000 // 完成的请求数超过该值时压缩日志
+)
+
+// Restorer 可恢复请求的调度器。
+// 引擎启动时调用 Restore 取回上次未完成的请求，lookup 根据任务名返回任务，返回 nil 表示任务不存在。
+type Restorer interface {
+	Restore(lookup func(taskName string) *collect.Task) ([]*collect.Request, error)
+}
+
+// diskEntry 日志条目
+type diskEntry struct {
+	Op  string                 `json:"op"` // push 或 done
+	Seq uint64                 `json:"seq"`
+	Req *collect.RequestRecord `json:"req,omitempty"`
+}
+
+// DiskSchedule 持久化调度器，实际的调度由内部的 Scheduler 完成
+type DiskSchedule struct {
+	Scheduler
+	Logger *zap.Logger
+
+	path    string
+	mu      sync.Mutex
+	file    *os.File
+	seq     uint64
+	pending map[uint64]collect.RequestRecord // 尚未处理结束的请求
+	ids     map[*collect.Request]uint64
+	spilled []uint64 // 内部调度器溢写的请求的序号，按溢写的顺序排列
+	done    int      // 上次压缩后完成的请求数
+}
+
+// NewDiskSchedule 创建持久化调度器，日志储存在 dir 目录下
+func NewDiskSchedule(dir string, inner Scheduler) (*DiskSchedule, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &DiskSchedule{
+		Scheduler: inner,
+		Logger:    zap.NewNop(),
+		path:      filepath.Join(dir, diskLogName),
+		pending:   make(map[uint64]collect.RequestRecord),
+		ids:       make(map[*collect.Request]uint64),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	// 重写日志，只保留未完成的请求
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	if n, ok := inner.(SpillNotifier); ok {
+		n.OnSpill(s.spill, s.unspill)
+	}
+	return s, nil
+}
+
+// spill 内部调度器溢写请求后不再保留原来的请求，暂存请求的序号
+func (s *DiskSchedule) spill(req *collect.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seq := s.ids[req]
+	delete(s.ids, req)
+	s.spilled = append(s.spilled, seq)
+}
+
+// unspill 读回的请求是新创建的，对应到溢写时暂存的序号
+func (s *DiskSchedule) unspill(req *collect.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.spilled) == 0 {
+		return
+	}
+	seq := s.spilled[0]
+	s.spilled = s.spilled[1:]
+	if seq != 0 {
+		s.ids[req] = seq
+	}
+}
+
+// load 回放日志
+func (s *DiskSchedule) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e diskEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// 进程崩溃时最后一行可能没有写完整
+			s.Logger.Warn("skip broken schedule log entry", zap.Error(err))
+			continue
+		}
+		switch e.Op {
+		case "push":
+			if e.Req != nil {
+				s.pending[e.Seq] = *e.Req
+			}
+		case "done":
+			delete(s.pending, e.Seq)
+		}
+		if e.Seq > s.seq {
+			s.seq = e.Seq
+		}
+	}
+	return scanner.Err()
+}
+
+// seqs 按推入的顺序返回未完成的请求的序号
+func (s *DiskSchedule) seqs() []uint64 {
+	seqs := make([]uint64, 0, len(s.pending))
+	for seq := range s.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
+
+// compact 将未完成的请求按推入的顺序重写到新的日志文件中
+func (s *DiskSchedule) compact() error {
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, seq := range s.seqs() {
+		rec := s.pending[seq]
+		if err := writeEntry(w, diskEntry{Op: "push", Seq: seq, Req: &rec}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	s.done = 0
+	return nil
+}
+
+func writeEntry(w interface{ Write([]byte) (int, error) }, e diskEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// Restore 按推入的顺序返回上次未完成的请求。
+// 任务不存在的请求保留在日志中，之后以包含该任务的配置启动时再恢复。
+func (s *DiskSchedule) Restore(lookup func(taskName string) *collect.Task) ([]*collect.Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reqs []*collect.Request
+	for _, seq := range s.seqs() {
+		rec := s.pending[seq]
+		task := lookup(rec.TaskName)
+		if task == nil {
+			s.Logger.Warn("restored request task not found, keep it",
+				zap.String("task", rec.TaskName),
+				zap.String("url", rec.Url),
+			)
+			continue
+		}
+		req := rec.Request(task)
+		// 已经在日志中，重新推入时不再记录
+		s.ids[req] = seq
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+func (s *DiskSchedule) Schedule(ctx context.Context) {
+	s.Scheduler.Schedule(ctx)
+}
+
+// Push 先将请求写入日志，再交给内部调度器。
+// 调度器停止后推入的请求仍会写入日志，下次启动时恢复。
+func (s *DiskSchedule) Push(reqs ...*collect.Request) {
+	s.record(reqs...)
+	s.Scheduler.Push(reqs...)
+}
+
+// record 将还未记录的请求写入日志
+func (s *DiskSchedule) record(reqs ...*collect.Request) {
+	s.mu.Lock()
+	for _, req := range reqs {
+		if _, ok := s.ids[req]; ok {
+			continue
+		}
+		s.seq++
+		rec := req.Record()
+		if err := writeEntry(s.file, diskEntry{Op: "push", Seq: s.seq, Req: &rec}); err != nil {
+			s.Logger.Error("write schedule log failed", zap.Error(err), zap.String("url", req.Url))
+		}
+		s.pending[s.seq] = rec
+		s.ids[req] = s.seq
+	}
+	s.mu.Unlock()
+}
+
+// Complete 请求处理结束后在日志中标记为完成，取出后还未处理结束的请求重启后仍会恢复
+func (s *DiskSchedule) Complete(req *collect.Request) {
+	s.markDone(req)
+}
+
+// OnDrop 内部调度器丢弃请求时，同样在日志中标记为完成
+func (s *DiskSchedule) OnDrop(f func(req *collect.Request)) {
+	n, ok := s.Scheduler.(DropNotifier)
+	if !ok {
+		return
+	}
+	n.OnDrop(func(req *collect.Request) {
+		s.markDone(req)
+		f(req)
+	})
+}
+
+func (s *DiskSchedule) markDone(req *collect.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seq, ok := s.ids[req]
+	if !ok {
+		return
+	}
+	delete(s.ids, req)
+	delete(s.pending, seq)
+	if err := writeEntry(s.file, diskEntry{Op: "done", Seq: seq}); err != nil {
+		s.Logger.Error("write schedule log failed", zap.Error(err), zap.String("url", req.Url))
+	}
+	s.done++
+	if s.done > diskCompactInterval && s.done > len(s.pending) {
+		if err := s.compact(); err != nil {
+			s.Logger.Error("compact schedule log failed", zap.Error(err))
+		}
+	}
+}
+
+// Close 关闭日志文件
+func (s *DiskSchedule) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Sync()
+	s.file.Close()
+	s.file = nil
+	return err
+}
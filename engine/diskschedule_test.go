@@ -0,0 +1,78 @@
+package engine_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func restoreURLs(t *testing.T, dir string, tasks ...*collect.Task) []string {
+	s, err := engine.NewDiskSchedule(dir, engine.NewSchedule())
+	require.NoError(t, err)
+	defer s.Close()
+	reqs, err := s.Restore(func(name string) *collect.Task {
+		for _, task := range tasks {
+			if task.Name == name {
+				return task
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	var urls []string
+	for _, req := range reqs {
+		urls = append(urls, req.Url)
+	}
+	return urls
+}
+
+func TestDiskScheduleRestore(t *testing.T) {
+	dir := t.TempDir()
+	a := &collect.Task{Property: collect.Property{Name: "a"}}
+	b := &collect.Task{Property: collect.Property{Name: "b"}}
+
+	s, err := engine.NewDiskSchedule(dir, engine.NewSchedule())
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Schedule(ctx)
+
+	var reqs []*collect.Request
+	for _, u := range []string{"a1", "a2", "a3", "a4", "a5"} {
+		reqs = append(reqs, &collect.Request{Task: a, Url: u})
+	}
+	s.Push(reqs...)
+	s.Push(&collect.Request{Task: b, Url: "b1"})
+
+	// a1 处理完成，a2 取出后进程崩溃
+	done := s.Pull()
+	s.Complete(done)
+	s.Pull()
+	cancel()
+	require.NoError(t, s.Close())
+
+	assert.Equal(t, []string{"a2", "a3", "a4", "a5"}, restoreURLs(t, dir, a))
+	// 任务 b 不在上次的配置中，请求仍然保留
+	assert.Equal(t, []string{"a2", "a3", "a4", "a5", "b1"}, restoreURLs(t, dir, a, b))
+}
+
+func TestDiskScheduleSpilledRequestsDone(t *testing.T) {
+	dir := t.TempDir()
+	s, err := engine.NewDiskSchedule(dir, engine.NewSchedule(
+		engine.WithQueueSize(2, engine.FullSpill),
+		engine.WithSpillDir(t.TempDir()),
+	))
+	require.NoError(t, err)
+	task := listTask("disk", 20)
+	e := newTestEngine(&fakeFetcher{}, s, []*collect.Task{task})
+	runEngine(t, e, 5*time.Second)
+
+	summary, _ := e.Summary("disk")
+	assert.EqualValues(t, 21, summary.Fetched)
+	// 溢写后读回的请求同样标记为完成，重启后不再恢复
+	assert.Empty(t, restoreURLs(t, dir, task))
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nico612/crawler-go/collect"
+	"go.uber.org/zap"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// SetFailure 处理失败的请求，按任务的重试策略延迟重试，重试次数用尽后放入死信队列
+func (c *Crawler) SetFailure(req *collect.Request, err error) {
+	c.forget(req)
+
+	policy := req.Task.Retry.WithDefaults()
+	attempt := req.Retry + 1
+	if policy.ShouldRetry(err, attempt) {
+		req.Retry++
+		delay := policy.Delay(err, attempt)
+		c.Logger.Info("retry request",
+			zap.String("url", req.Url),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+		atomic.AddInt64(&c.retrying, 1)
+		time.AfterFunc(delay, func() {
+			atomic.AddInt64(&c.retrying, -1)
+			c.scheduler.Push(req)
+		})
+		return
+	}
+	c.giveUp(req, err, attempt)
+}
+
+// forget 删除请求的访问记录，使请求可以重试或重新加入调度
+func (c *Crawler) forget(req *collect.Request) {
+	if req.Task.Reload {
+		return
+	}
+	if err := c.deduper(req.Task).Delete(req.Unique()); err != nil {
+		c.Logger.Error("delete visited failed", zap.Error(err), zap.String("url", req.Url))
+	}
+}
+
+// giveUp 请求永久失败，放入死信队列
+func (c *Crawler) giveUp(req *collect.Request, err error, attempt int) {
+	letter := DeadLetter{
+		ID:       req.Unique(),
+		Request:  req.Record(),
+		Attempts: attempt,
+		Time:     time.Now(),
+	}
+	if err != nil {
+		letter.Err = err.Error()
+	}
+	c.finish(req, resultFailed)
+	if err := c.DeadLetter.Add(letter); err != nil {
+		c.Logger.Error("add dead letter failed", zap.Error(err), zap.String("url", req.Url))
+		return
+	}
+	c.Logger.Warn("request failed permanently",
+		zap.String("url", req.Url),
+		zap.Int("attempts", attempt),
+		zap.String("err", letter.Err),
+	)
+}
+
+// DeadLetters 返回死信队列中的所有请求
+func (c *Crawler) DeadLetters() ([]DeadLetter, error) {
+	return c.DeadLetter.List()
+}
+
+// ExportDeadLetters 将死信以每行一条 JSON 的格式写入 w
+func (c *Crawler) ExportDeadLetters(w io.Writer) error {
+	letters, err := c.DeadLetter.List()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for _, l := range letters {
+		if err := enc.Encode(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Requeue 将死信重新加入调度，ids 为空时重新加入所有死信，需要在引擎运行时调用。
+// 返回重新加入调度的请求数，所属任务不存在的死信会被保留。
+func (c *Crawler) Requeue(ids ...string) (int, error) {
+	letters, err := c.DeadLetter.List()
+	if err != nil {
+		return 0, err
+	}
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+
+	var reqs []*collect.Request
+	var requeued []string
+	for _, l := range letters {
+		if len(ids) > 0 && !want[l.ID] {
+			continue
+		}
+		task := c.task(l.Request.TaskName)
+		if task == nil {
+			c.Logger.Warn("dead letter task not found",
+				zap.String("id", l.ID),
+				zap.String("task", l.Request.TaskName),
+			)
+			continue
+		}
+		req := l.Request.Request(task)
+		req.Retry = 0
+		reqs = append(reqs, req)
+		requeued = append(requeued, l.ID)
+	}
+	if len(requeued) == 0 {
+		return 0, nil
+	}
+	if err := c.DeadLetter.Remove(requeued...); err != nil {
+		return 0, fmt.Errorf("remove dead letters: %w", err)
+	}
+	c.push(reqs...)
+	return len(reqs), nil
+}
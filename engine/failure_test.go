@@ -0,0 +1,81 @@
+package engine_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func countURL(urls []string, url string) int {
+	n := 0
+	for _, u := range urls {
+		if u == url {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRetryThenDeadLetter(t *testing.T) {
+	f := &fakeFetcher{get: func(req *collect.Request) (*collect.Response, error) {
+		if strings.HasSuffix(req.Url, "/item/0") {
+			return nil, errors.New("connection reset")
+		}
+		return &collect.Response{StatusCode: 200, Body: []byte(req.Url), URL: req.Url}, nil
+	}}
+	task := listTask("retry", 2)
+	task.Retry = collect.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	e := newTestEngine(f, engine.NewSchedule(), []*collect.Task{task})
+	runEngine(t, e, 5*time.Second)
+
+	assert.Equal(t, 3, countURL(f.fetched(), "http://retry/item/0"))
+	letters, err := e.DeadLetters()
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, "http://retry/item/0", letters[0].Request.Url)
+	assert.Equal(t, 3, letters[0].Attempts)
+	assert.Contains(t, letters[0].Err, "connection reset")
+	summary, _ := e.Summary("retry")
+	assert.EqualValues(t, 2, summary.Fetched)
+	assert.EqualValues(t, 1, summary.Failed)
+}
+
+func TestBannedResponseFails(t *testing.T) {
+	var mu sync.Mutex
+	var banned []time.Time
+	f := &fakeFetcher{get: func(req *collect.Request) (*collect.Response, error) {
+		body := req.Url
+		if strings.HasSuffix(req.Url, "/item/0") {
+			mu.Lock()
+			banned = append(banned, time.Now())
+			mu.Unlock()
+			body = "/misc/sorry"
+		}
+		return &collect.Response{StatusCode: 200, Body: []byte(body), URL: req.Url}, nil
+	}}
+	task := listTask("banned", 2)
+	task.Retry = collect.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, BanDelay: 200 * time.Millisecond}
+	task.Validators = []collect.Validator{collect.Banned(collect.NotMatch("/misc/sorry"))}
+	e := newTestEngine(f, engine.NewSchedule(), []*collect.Task{task})
+	runEngine(t, e, 5*time.Second)
+
+	// 返回了验证页面的请求按失败处理，不会当作正常页面解析
+	letters, err := e.DeadLetters()
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, 2, letters[0].Attempts)
+	assert.True(t, strings.HasPrefix(letters[0].Err, string(collect.FailureBanned)))
+	summary, _ := e.Summary("banned")
+	assert.EqualValues(t, 2, summary.Fetched)
+	assert.EqualValues(t, 1, summary.Failed)
+	// 被封禁后按 BanDelay 等待，而不是按 BaseDelay 立即重试
+	require.Len(t, banned, 2)
+	assert.GreaterOrEqual(t, banned[1].Sub(banned[0]), 150*time.Millisecond)
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"context"
+	"github.com/nico612/crawler-go/collect"
+	"go.uber.org/zap"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 按域名调度
+// 同时爬取多个网站时，单一队列会让某个网站突发的大量请求占满所有 worker，其他网站的请求迟迟得不到处理，
+// 同时也会对该网站造成较大的压力。HostSchedule 为每个域名维护一个队列，轮询各个域名分发请求，
+// 并保证同一域名的两次请求之间至少间隔 Delay。
+
+// hostQueue 单个域名的请求队列
+type hostQueue struct {
+	requestQueue
+	host  string
+	ready time.Time // 该域名下次可以分发请求的时间
+}
+
+// HostSchedule 按域名划分队列的礼貌调度器
+type HostSchedule struct {
+	requestCh chan *collect.Request
+	workerCh  chan *collect.Request
+	done      chan struct{}
+
+	Delay     time.Duration            // 同一域名两次请求的最小间隔
+	HostDelay map[string]time.Duration // 单独设置某些域名的请求间隔
+	Logger    *zap.Logger
+
+	hosts []*hostQueue // 轮询顺序
+	index map[string]*hostQueue
+	next  int // 轮询游标
+}
+
+func NewHostSchedule(delay time.Duration) *HostSchedule {
+	s := &HostSchedule{}
+	s.requestCh = make(chan *collect.Request)
+	s.workerCh = make(chan *collect.Request)
+	s.done = make(chan struct{})
+	s.Delay = delay
+	s.HostDelay = make(map[string]time.Duration)
+	s.Logger = zap.NewNop()
+	s.index = make(map[string]*hostQueue)
+	return s
+}
+
+func (s *HostSchedule) Schedule(ctx context.Context) {
+	go func() {
+		defer close(s.done)
+
+		var req *collect.Request
+		var host *hostQueue
+		var ch chan *collect.Request
+		timer := time.NewTimer(time.Hour)
+		timer.Stop()
+		defer timer.Stop()
+
+		for {
+			var timerC <-chan time.Time
+			if req == nil {
+				var wait time.Duration
+				req, host, wait = s.pick(time.Now())
+				if req != nil {
+					ch = s.workerCh
+				} else if wait > 0 {
+					timer.Reset(wait)
+					timerC = timer.C
+				}
+			}
+
+			select {
+			case r := <-s.requestCh:
+				s.push(r)
+			case ch <- req:
+				host.ready = time.Now().Add(s.delay(host.host))
+				req = nil
+				host = nil
+				ch = nil
+			case <-timerC:
+			case <-ctx.Done():
+				return
+			}
+
+			if timerC != nil && !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+	}()
+}
+
+func (s *HostSchedule) delay(host string) time.Duration {
+	if d, ok := s.HostDelay[host]; ok {
+		return d
+	}
+	return s.Delay
+}
+
+func (s *HostSchedule) push(req *collect.Request) {
+	host := requestHost(req)
+	q, ok := s.index[host]
+	if !ok {
+		q = &hostQueue{host: host}
+		s.index[host] = q
+		s.hosts = append(s.hosts, q)
+	}
+	q.push(req, time.Now())
+}
+
+// pick 从轮询游标开始找到第一个可以分发的域名并取出请求。
+// 没有可分发的请求时返回最近一个域名可用前需要等待的时间，所有队列为空时返回 0。
+func (s *HostSchedule) pick(now time.Time) (*collect.Request, *hostQueue, time.Duration) {
+	var wait time.Duration
+	for i := 0; i < len(s.hosts); {
+		idx := (s.next + i) % len(s.hosts)
+		q := s.hosts[idx]
+		if q.len() == 0 {
+			// 空队列在间隔结束后移除，避免域名越来越多
+			if !now.Before(q.ready) {
+				s.remove(idx)
+				continue
+			}
+			i++
+			continue
+		}
+		if now.Before(q.ready) {
+			if d := q.ready.Sub(now); wait == 0 || d < wait {
+				wait = d
+			}
+			i++
+			continue
+		}
+		s.next = (idx + 1) % len(s.hosts)
+		return q.pop(), q, 0
+	}
+	return nil, nil, wait
+}
+
+func (s *HostSchedule) remove(idx int) {
+	delete(s.index, s.hosts[idx].host)
+	s.hosts = append(s.hosts[:idx], s.hosts[idx+1:]...)
+	if s.next > idx {
+		s.next--
+	}
+	if len(s.hosts) == 0 || s.next >= len(s.hosts) {
+		s.next = 0
+	}
+}
+
+// requestHost 返回请求的域名
+func requestHost(req *collect.Request) string {
+	u, err := url.Parse(req.Url)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+func (s *HostSchedule) Pull() *collect.Request {
+	select {
+	case r := <-s.workerCh:
+		return r
+	case <-s.done:
+		return nil
+	}
+}
+
+func (s *HostSchedule) Push(reqs ...*collect.Request) {
+	for _, req := range reqs {
+		select {
+		case s.requestCh <- req:
+		case <-s.done:
+			return
+		}
+	}
+}
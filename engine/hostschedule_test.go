@@ -0,0 +1,50 @@
+package engine_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/engine"
+	"github.com/stretchr/testify/assert"
+)
+
+func hostRequests(urls ...string) []*collect.Request {
+	var reqs []*collect.Request
+	for _, u := range urls {
+		reqs = append(reqs, &collect.Request{Url: u})
+	}
+	return reqs
+}
+
+func TestHostScheduleFairness(t *testing.T) {
+	s := engine.NewHostSchedule(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Schedule(ctx)
+
+	s.Push(hostRequests("http://a/1", "http://a/2", "http://a/3", "http://a/4", "http://b/1", "http://b/2")...)
+	var pulled []string
+	for i := 0; i < 6; i++ {
+		pulled = append(pulled, s.Pull().Url)
+	}
+	// 域名 a 的请求再多，也不会让域名 b 一直等待
+	assert.Equal(t, []string{"http://a/1", "http://a/2", "http://b/1", "http://a/3", "http://b/2", "http://a/4"}, pulled)
+}
+
+func TestHostScheduleDelay(t *testing.T) {
+	s := engine.NewHostSchedule(100 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Schedule(ctx)
+
+	start := time.Now()
+	s.Push(hostRequests("http://a/1", "http://a/2", "http://b/1")...)
+	assert.Equal(t, "http://a/1", s.Pull().Url)
+	// 域名 a 还在间隔内，先分发域名 b
+	assert.Equal(t, "http://b/1", s.Pull().Url)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, "http://a/2", s.Pull().Url)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nico612/crawler-go/collect"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// 登录
+// 任务每次运行开始前使用每个会话登录，登录成功的会话数为 0 时任务无法开始。
+// 抓取时响应表示会话已失效，使用该会话重新登录后按重试策略重试请求；
+// 多个请求同时发现同一个会话失效时只登录一次。
+
+// errNoSession 需要登录的任务没有会话，通常是会话加载失败
+var errNoSession = errors.New("login requires session")
+
+// loginState 单个会话的登录状态
+type loginState struct {
+	mu sync.Mutex
+	at time.Time // 最近一次登录成功的时间
+}
+
+// loginState 返回任务的会话的登录状态
+func (c *Crawler) loginState(task, session string) *loginState {
+	c.sessionLock.Lock()
+	defer c.sessionLock.Unlock()
+	key := task + "/" + session
+	st, ok := c.logins[key]
+	if !ok {
+		st = &loginState{}
+		c.logins[key] = st
+	}
+	return st
+}
+
+// login 使用任务的每个会话登录，设置了 CheckURL 时跳过仍然有效的会话
+func (c *Crawler) login(task *collect.Task) error {
+	if !task.Login.Enabled() {
+		return nil
+	}
+	if task.Sessions == nil {
+		return errNoSession
+	}
+	var ok int
+	var lastErr error
+	for _, s := range task.Sessions.Sessions() {
+		valid, err := task.LoggedIn(s.Name)
+		if err != nil {
+			c.Logger.Warn("check session failed", zap.String("task", task.Name), zap.String("session", s.Name), zap.Error(err))
+		}
+		if valid {
+			c.Logger.Debug("session still valid", zap.String("task", task.Name), zap.String("session", s.Name))
+			ok++
+			continue
+		}
+		if err := c.signIn(task, s.Name, time.Time{}); err != nil {
+			lastErr = err
+			continue
+		}
+		ok++
+	}
+	c.saveSession(task)
+	if ok == 0 {
+		return fmt.Errorf("login failed: %w", lastErr)
+	}
+	return nil
+}
+
+// signIn 使用会话登录，since 之后已经登录过时不再登录
+func (c *Crawler) signIn(task *collect.Task, session string, since time.Time) error {
+	st := c.loginState(task.Name, session)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !since.IsZero() && st.at.After(since) {
+		return nil
+	}
+	if err := task.SignIn(session); err != nil {
+		c.Logger.Error("login failed", zap.String("task", task.Name), zap.String("session", session), zap.Error(err))
+		return err
+	}
+	st.at = time.Now()
+	c.Logger.Info("login", zap.String("task", task.Name), zap.String("session", session))
+	return nil
+}
+
+// sessionExpired 请求发现会话已失效，重新登录后重试请求，start 为请求开始抓取的时间
+func (c *Crawler) sessionExpired(req *collect.Request, start time.Time) {
+	task := req.Task
+	c.Logger.Warn("session expired", zap.String("task", task.Name), zap.String("session", req.Session), zap.String("url", req.Url))
+	sessions := []string{req.Session}
+	if req.Session == "" {
+		// 抓取器没有使用会话，重新登录所有会话
+		sessions = sessions[:0]
+		for _, s := range task.Sessions.Sessions() {
+			sessions = append(sessions, s.Name)
+		}
+	}
+	var err error
+	for _, name := range sessions {
+		if e := c.signIn(task, name, start); e != nil {
+			err = e
+		}
+	}
+	c.saveSession(task)
+	if err == nil {
+		err = fmt.Errorf("%w: %v", collect.ErrRetry, collect.ErrSessionExpired)
+	}
+	c.SetFailure(req, err)
+}
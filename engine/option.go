@@ -2,21 +2,53 @@ package engine
 
 import (
 	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/dedup"
+	"github.com/nico612/crawler-go/pipeline"
 	"go.uber.org/zap"
+	"os"
+	"sort"
+	"time"
 )
 
 type options struct {
-	WorkCount int             // 任务处理协程数量
-	Fetcher   collect.Fetcher // 请求处理器
-	Logger    *zap.Logger     // 日志
-	Seeds     []*collect.Task // 任务列表
-	scheduler Scheduler
+	WorkCount     int             // 任务处理协程数量，开启自适应调整时为初始数量
+	MinWorkers    int             // 自适应调整时最少的 worker 数
+	MaxWorkers    int             // 自适应调整时最多的 worker 数，为 0 时不调整
+	AdaptInterval time.Duration   // 自适应调整的间隔
+	Fetcher       collect.Fetcher // 请求处理器
+	Logger        *zap.Logger     // 日志
+	Seeds         []*collect.Task // 任务列表，根据任务名从 Registry 中找到对应的任务
+	Registry      *TaskRegistry   // 任务注册表
+	scheduler     Scheduler
+	Deduper       dedup.Deduper // 请求去重
+
+	DeadLetter DeadLetterStore   // 重试后仍然失败的请求
+	PageCache  collect.PageCache // 增量抓取的页面状态
+
+	Middlewares []collect.Middleware // 所有任务共用的中间件，在任务的中间件之前执行
+	Pipeline    *pipeline.Pipeline   // 所有任务共用的数据处理管道，在任务的管道之前执行
+
+	ShutdownTimeout time.Duration // 停止时等待正在执行的请求完成的最长时间
+
+	ResultWorkers  int           // 结果处理协程数量
+	ResultBuffer   int           // 结果通道的缓冲大小
+	SaveRetry      int           // 储存数据的最大尝试次数
+	SaveRetryDelay time.Duration // 储存失败后重试的间隔，第 n 次重试前等待 n 倍的间隔
+
+	OnTaskDone   func(TaskSummary)   // 单个任务完成时回调
+	OnDone       func([]TaskSummary) // 所有任务完成时回调
+	StopWhenDone bool                // 所有任务完成后 Run 返回
 }
 
 type Option func(opts *options)
 
 var defaultOptionss = options{
-	Logger: zap.NewNop(),
+	Logger:          zap.NewNop(),
+	ShutdownTimeout: 30 * time.Second,
+	AdaptInterval:   5 * time.Second,
+	ResultWorkers:   1,
+	SaveRetry:       3,
+	SaveRetryDelay:  time.Second,
 }
 
 func WithLogger(logger *zap.Logger) Option {
@@ -37,14 +69,178 @@ func WithWorkCount(workCount int) Option {
 	}
 }
 
+// WithAdaptiveWorkers 根据队列深度、抓取延迟、错误率和限速等待时间在 min 和 max 之间自动调整 worker 数量
+func WithAdaptiveWorkers(min, max int) Option {
+	return func(opts *options) {
+		opts.MinWorkers = min
+		opts.MaxWorkers = max
+	}
+}
+
+// WithAdaptInterval 设置自适应调整 worker 数量的间隔
+func WithAdaptInterval(interval time.Duration) Option {
+	return func(opts *options) {
+		opts.AdaptInterval = interval
+	}
+}
+
 func WithSeeds(seeds []*collect.Task) Option {
 	return func(opts *options) {
 		opts.Seeds = seeds
 	}
 }
 
+func WithRegistry(registry *TaskRegistry) Option {
+	return func(opts *options) {
+		opts.Registry = registry
+	}
+}
+
 func WithScheduler(scheduler Scheduler) Option {
 	return func(opts *options) {
 		opts.scheduler = scheduler
 	}
 }
+
+func WithDeadLetter(store DeadLetterStore) Option {
+	return func(opts *options) {
+		opts.DeadLetter = store
+	}
+}
+
+// WithPageCache 设置增量抓取的页面状态储存，需要跨进程保留时使用 collect.FilePageCache
+func WithPageCache(cache collect.PageCache) Option {
+	return func(opts *options) {
+		opts.PageCache = cache
+	}
+}
+
+// WithMiddleware 添加所有任务共用的中间件，按添加顺序执行
+func WithMiddleware(mws ...collect.Middleware) Option {
+	return func(opts *options) {
+		opts.Middlewares = append(opts.Middlewares, mws...)
+	}
+}
+
+func WithPipeline(p *pipeline.Pipeline) Option {
+	return func(opts *options) {
+		opts.Pipeline = p
+	}
+}
+
+func WithDeduper(deduper dedup.Deduper) Option {
+	return func(opts *options) {
+		opts.Deduper = deduper
+	}
+}
+
+// WithResultWorkers 设置结果处理协程数量和结果通道的缓冲大小
+func WithResultWorkers(workers, buffer int) Option {
+	return func(opts *options) {
+		opts.ResultWorkers = workers
+		opts.ResultBuffer = buffer
+	}
+}
+
+// WithSaveRetry 设置储存数据的最大尝试次数和重试间隔
+func WithSaveRetry(attempts int, delay time.Duration) Option {
+	return func(opts *options) {
+		opts.SaveRetry = attempts
+		opts.SaveRetryDelay = delay
+	}
+}
+
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.ShutdownTimeout = timeout
+	}
+}
+
+// FullPolicy 队列已满时的处理策略
+type FullPolicy int
+
+const (
+	// FullBlock 阻塞 Push 直到队列有空位，超过 blockTimeout 后丢弃请求。
+	// worker 推入解析得到的请求时同样会阻塞，解析出大量请求的任务建议使用 FullSpill
+	FullBlock FullPolicy = iota
+	// FullDropLowest 丢弃队列中优先级最低的请求
+	FullDropLowest
+	// FullSpill 将优先级最低的请求溢写到磁盘，队列有空位时再读回
+	FullSpill
+)
+
+func WithOnTaskDone(f func(TaskSummary)) Option {
+	return func(opts *options) {
+		opts.OnTaskDone = f
+	}
+}
+
+func WithOnDone(f func([]TaskSummary)) Option {
+	return func(opts *options) {
+		opts.OnDone = f
+	}
+}
+
+// WithStopWhenDone 所有任务完成后停止引擎，适用于定时执行的一次性爬取
+func WithStopWhenDone(stop bool) Option {
+	return func(opts *options) {
+		opts.StopWhenDone = stop
+	}
+}
+
+// scheduleOptions 调度器 Schedule 的配置
+type scheduleOptions struct {
+	aging        time.Duration // 优先级老化间隔
+	bands        []int64       // 优先级区间下界，用于统计队列深度
+	queueSize    int           // 队列最大长度，为 0 时不限制
+	fullPolicy   FullPolicy    // 队列已满时的处理策略
+	blockTimeout time.Duration // FullBlock 策略下 Push 最长的阻塞时间，为 0 时一直阻塞
+	spillDir     string        // FullSpill 策略下溢写文件的目录
+}
+
+type ScheduleOption func(opts *scheduleOptions)
+
+var defaultScheduleOptions = scheduleOptions{
+	blockTimeout: 30 * time.Second,
+	spillDir:     os.TempDir(),
+}
+
+// WithAging 设置优先级老化间隔，请求每等待 aging 时间优先级提升 1，为 0 时不老化
+func WithAging(aging time.Duration) ScheduleOption {
+	return func(opts *scheduleOptions) {
+		opts.aging = aging
+	}
+}
+
+// WithPriorityBands 设置统计队列深度的优先级区间下界，例如 0, 1, 100
+func WithPriorityBands(bands ...int64) ScheduleOption {
+	return func(opts *scheduleOptions) {
+		opts.bands = append([]int64(nil), bands...)
+		sort.Slice(opts.bands, func(i, j int) bool {
+			return opts.bands[i] < opts.bands[j]
+		})
+	}
+}
+
+// WithQueueSize 设置队列最大长度以及队列已满时的处理策略
+func WithQueueSize(size int, policy FullPolicy) ScheduleOption {
+	return func(opts *scheduleOptions) {
+		opts.queueSize = size
+		opts.fullPolicy = policy
+	}
+}
+
+// WithBlockTimeout 设置 FullBlock 策略下 Push 最长的阻塞时间，超时后无法推入的请求会被丢弃。
+// 所有 worker 都阻塞在推入上时没有 worker 取出请求，只能等到超时，因此不建议设置为 0。
+func WithBlockTimeout(timeout time.Duration) ScheduleOption {
+	return func(opts *scheduleOptions) {
+		opts.blockTimeout = timeout
+	}
+}
+
+// WithSpillDir 设置 FullSpill 策略下溢写文件的目录
+func WithSpillDir(dir string) ScheduleOption {
+	return func(opts *scheduleOptions) {
+		opts.spillDir = dir
+	}
+}
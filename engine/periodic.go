@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"context"
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/cron"
+	"go.uber.org/zap"
+	"time"
+)
+
+// 周期任务
+// 设置了 Cron 的任务会按计划重新执行 Rule.Root()，每次执行都是一次新的运行，请求按运行分别去重。
+// 触发时上一次运行还未结束，根据 Overlap 跳过本次触发或等待上一次运行结束后开始。
+
+// runPeriodic 按计划触发任务，ctx 取消后返回
+func (c *Crawler) runPeriodic(ctx context.Context, name string, sched cron.Schedule) {
+	for {
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			c.Logger.Warn("task cron will never fire again", zap.String("task", name))
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		c.trigger(name)
+	}
+}
+
+// trigger 定时触发任务
+func (c *Crawler) trigger(name string) {
+	c.taskLock.Lock()
+	if run, ok := c.runs[name]; ok && (run.state == TaskRunning || run.state == TaskPaused) {
+		queue := run.task.Overlap == collect.OverlapQueue
+		run.queued = run.queued || queue
+		c.taskLock.Unlock()
+		c.Logger.Info("task still running when triggered",
+			zap.String("task", name),
+			zap.Bool("queued", queue),
+		)
+		return
+	}
+	c.taskLock.Unlock()
+
+	if err := c.StartTask(name); err != nil {
+		c.Logger.Error("start periodic task failed", zap.String("task", name), zap.Error(err))
+	}
+}
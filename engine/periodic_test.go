@@ -0,0 +1,25 @@
+package engine
+
+import (
+	"github.com/nico612/crawler-go/collect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunVisitedDroppedWhenRunDone(t *testing.T) {
+	c := NewEngine()
+	first := &collect.Task{Property: collect.Property{Name: "cron", Cron: "* * * * *"}, RunID: "cron-1"}
+	second := &collect.Task{Property: collect.Property{Name: "cron", Cron: "* * * * *"}, RunID: "cron-2"}
+	req := &collect.Request{Task: first, Url: "http://cron/page"}
+
+	c.StoreVisited(req)
+	assert.True(t, c.HasVisited(req))
+	// 每次运行分别去重，也不写入引擎的去重记录
+	assert.False(t, c.HasVisited(&collect.Request{Task: second, Url: req.Url}))
+	assert.False(t, c.Deduper.Has(req.Unique()))
+
+	c.taskDone(first)
+	assert.NotContains(t, c.runVisited, first)
+	assert.Contains(t, c.runVisited, second)
+}
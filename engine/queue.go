@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"container/heap"
+	"github.com/nico612/crawler-go/collect"
+	"time"
+)
+
+// queueItem 队列中的请求
+type queueItem struct {
+	req      *collect.Request
+	seq      uint64    // 入队顺序
+	enqueued time.Time // 入队时间
+	boost    int64     // 等待时间带来的优先级提升
+	rank     float64   // 按任务的遍历策略计算的排序值，优先级相同时越大越先处理
+	order    int64     // 排序值相同时越小越先处理，先进先出时为入队顺序，后进先出时为入队顺序的相反数
+}
+
+func (i *queueItem) priority() int64 {
+	return i.req.Priority + i.boost
+}
+
+// strategyRank 根据任务的遍历策略计算请求的排序值，返回 lifo 表示排序值相同时后进先出
+func strategyRank(req *collect.Request) (rank float64, lifo bool) {
+	switch req.Task.Strategy {
+	case collect.StrategyBFS:
+		return -float64(req.Depth), false
+	case collect.StrategyDFS:
+		return float64(req.Depth), true
+	case collect.StrategyBestFirst:
+		if req.Task.Score != nil {
+			return req.Task.Score(req), false
+		}
+	}
+	return 0, false
+}
+
+// requestHeap 同一个任务的请求按优先级排序的堆，优先级相同时按遍历策略排序，默认先进先出
+type requestHeap []*queueItem
+
+func (h requestHeap) Len() int { return len(h) }
+
+func (h requestHeap) Less(i, j int) bool {
+	pi, pj := h[i].priority(), h[j].priority()
+	if pi != pj {
+		return pi > pj
+	}
+	if h[i].rank != h[j].rank {
+		return h[i].rank > h[j].rank
+	}
+	return h[i].order < h[j].order
+}
+
+func (h requestHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *requestHeap) Push(x interface{}) {
+	*h = append(*h, x.(*queueItem))
+}
+
+func (h *requestHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// taskQueue 单个任务的请求堆，遍历策略的排序值只在同一个任务的请求之间比较
+type taskQueue struct {
+	items  requestHeap
+	served uint64 // 上次出队的轮次
+}
+
+// requestQueue 优先级队列，非并发安全，由调度协程独占。
+// 每个任务的请求单独排序，出队时取各任务队首中优先级最高的请求，优先级相同时各任务轮流出队，
+// 避免某个任务的遍历策略影响其他任务。
+// aging 大于 0 时，请求每等待 aging 时间优先级提升 1，避免低优先级的请求一直得不到处理。
+type requestQueue struct {
+	queues map[*collect.Task]*taskQueue
+	n      int
+	seq    uint64
+	turn   uint64 // 出队的轮次
+	aging  time.Duration
+}
+
+func (q *requestQueue) push(req *collect.Request, now time.Time) {
+	q.seq++
+	item := &queueItem{
+		req:      req,
+		seq:      q.seq,
+		enqueued: now,
+		order:    int64(q.seq),
+	}
+	if req.Task != nil {
+		var lifo bool
+		item.rank, lifo = strategyRank(req)
+		if lifo {
+			item.order = -item.order
+		}
+	}
+	if q.queues == nil {
+		q.queues = make(map[*collect.Task]*taskQueue)
+	}
+	tq, ok := q.queues[req.Task]
+	if !ok {
+		tq = &taskQueue{}
+		q.queues[req.Task] = tq
+	}
+	heap.Push(&tq.items, item)
+	q.n++
+}
+
+// head 返回下一个出队的任务，优先级相同时选择最久没有出队的任务
+func (q *requestQueue) head() *taskQueue {
+	var best *taskQueue
+	for _, tq := range q.queues {
+		if best == nil {
+			best = tq
+			continue
+		}
+		ti, bi := tq.items[0], best.items[0]
+		switch {
+		case ti.priority() != bi.priority():
+			if ti.priority() > bi.priority() {
+				best = tq
+			}
+		case tq.served != best.served:
+			if tq.served < best.served {
+				best = tq
+			}
+		case ti.seq < bi.seq:
+			best = tq
+		}
+	}
+	return best
+}
+
+// remove 从任务的队列中移除第 i 个请求
+func (q *requestQueue) remove(tq *taskQueue, i int) *collect.Request {
+	req := heap.Remove(&tq.items, i).(*queueItem).req
+	q.n--
+	if len(tq.items) == 0 {
+		delete(q.queues, req.Task)
+	}
+	return req
+}
+
+func (q *requestQueue) pop() *collect.Request {
+	tq := q.head()
+	if tq == nil {
+		return nil
+	}
+	q.turn++
+	tq.served = q.turn
+	return q.remove(tq, 0)
+}
+
+// removeLowest 移除并返回优先级最低的请求，相同优先级时移除最晚入队的请求
+func (q *requestQueue) removeLowest() *collect.Request {
+	var lowestQueue *taskQueue
+	var lowest int
+	for _, tq := range q.queues {
+		l := 0
+		for i := 1; i < len(tq.items); i++ {
+			if tq.items.Less(l, i) {
+				l = i
+			}
+		}
+		if lowestQueue != nil {
+			li, ci := lowestQueue.items[lowest], tq.items[l]
+			if ci.priority() > li.priority() || (ci.priority() == li.priority() && ci.seq < li.seq) {
+				continue
+			}
+		}
+		lowestQueue, lowest = tq, l
+	}
+	if lowestQueue == nil {
+		return nil
+	}
+	return q.remove(lowestQueue, lowest)
+}
+
+func (q *requestQueue) peek() *collect.Request {
+	tq := q.head()
+	if tq == nil {
+		return nil
+	}
+	return tq.items[0].req
+}
+
+func (q *requestQueue) len() int {
+	return q.n
+}
+
+// age 根据等待时间重新计算优先级提升并调整堆
+func (q *requestQueue) age(now time.Time) {
+	if q.aging <= 0 || q.n == 0 {
+		return
+	}
+	for _, tq := range q.queues {
+		for _, item := range tq.items {
+			item.boost = int64(now.Sub(item.enqueued) / q.aging)
+		}
+		heap.Init(&tq.items)
+	}
+}
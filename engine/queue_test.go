@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"github.com/nico612/crawler-go/collect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestQueuePriority(t *testing.T) {
+	var q requestQueue
+	now := time.Now()
+	q.push(&collect.Request{Url: "root", Priority: 1}, now)
+	q.push(&collect.Request{Url: "normal"}, now)
+	q.push(&collect.Request{Url: "detail-1", Priority: 100}, now)
+	q.push(&collect.Request{Url: "detail-2", Priority: 100}, now)
+
+	var urls []string
+	for q.len() > 0 {
+		urls = append(urls, q.pop().Url)
+	}
+	assert.Equal(t, []string{"detail-1", "detail-2", "root", "normal"}, urls)
+}
+
+func TestRequestQueueAging(t *testing.T) {
+	q := requestQueue{aging: time.Second}
+	now := time.Now()
+	q.push(&collect.Request{Url: "old"}, now.Add(-10*time.Second))
+	q.push(&collect.Request{Url: "new", Priority: 5}, now)
+
+	assert.Equal(t, "new", q.peek().Url)
+	q.age(now)
+	assert.Equal(t, "old", q.pop().Url)
+}
+
+func TestRequestQueueStrategy(t *testing.T) {
+	pop := func(task *collect.Task) []string {
+		var q requestQueue
+		now := time.Now()
+		q.push(&collect.Request{Task: task, Url: "list-1"}, now)
+		q.push(&collect.Request{Task: task, Url: "detail-1", Depth: 1}, now)
+		q.push(&collect.Request{Task: task, Url: "list-2"}, now)
+		q.push(&collect.Request{Task: task, Url: "detail-2", Depth: 1}, now)
+		q.push(&collect.Request{Task: task, Url: "comment-2", Depth: 2}, now)
+		var urls []string
+		for q.len() > 0 {
+			urls = append(urls, q.pop().Url)
+		}
+		return urls
+	}
+
+	bfs := &collect.Task{Property: collect.Property{Strategy: collect.StrategyBFS}}
+	assert.Equal(t, []string{"list-1", "list-2", "detail-1", "detail-2", "comment-2"}, pop(bfs))
+
+	dfs := &collect.Task{Property: collect.Property{Strategy: collect.StrategyDFS}}
+	assert.Equal(t, []string{"comment-2", "detail-2", "detail-1", "list-2", "list-1"}, pop(dfs))
+
+	best := &collect.Task{
+		Property: collect.Property{Strategy: collect.StrategyBestFirst},
+		Score: func(r *collect.Request) float64 {
+			return float64(len(r.Url))
+		},
+	}
+	assert.Equal(t, []string{"comment-2", "detail-1", "detail-2", "list-1", "list-2"}, pop(best))
+}
+
+func TestRequestQueueTaskFairness(t *testing.T) {
+	var q requestQueue
+	now := time.Now()
+	// 深度优先任务的请求深度更大，但不会排在先进先出任务的请求之前
+	dfs := &collect.Task{Property: collect.Property{Name: "dfs", Strategy: collect.StrategyDFS}}
+	fifo := &collect.Task{Property: collect.Property{Name: "fifo"}}
+	q.push(&collect.Request{Task: fifo, Url: "fifo-1"}, now)
+	q.push(&collect.Request{Task: fifo, Url: "fifo-2"}, now)
+	q.push(&collect.Request{Task: dfs, Url: "dfs-1", Depth: 1}, now)
+	q.push(&collect.Request{Task: dfs, Url: "dfs-2", Depth: 2}, now)
+	q.push(&collect.Request{Task: dfs, Url: "dfs-3", Depth: 3}, now)
+	q.push(&collect.Request{Task: fifo, Url: "fifo-3", Priority: 1}, now)
+
+	var urls []string
+	for q.len() > 0 {
+		urls = append(urls, q.pop().Url)
+	}
+	assert.Equal(t, []string{"fifo-3", "dfs-3", "fifo-1", "dfs-2", "fifo-2", "dfs-1"}, urls)
+}
+
+func TestRequestQueueRemoveLowest(t *testing.T) {
+	var q requestQueue
+	now := time.Now()
+	a := &collect.Task{Property: collect.Property{Name: "a"}}
+	b := &collect.Task{Property: collect.Property{Name: "b"}}
+	q.push(&collect.Request{Task: a, Url: "a-1"}, now)
+	q.push(&collect.Request{Task: b, Url: "b-1", Priority: 1}, now)
+	q.push(&collect.Request{Task: b, Url: "b-2"}, now)
+	q.push(&collect.Request{Task: a, Url: "a-2", Priority: 1}, now)
+
+	assert.Equal(t, "b-2", q.removeLowest().Url)
+	assert.Equal(t, "a-1", q.removeLowest().Url)
+	assert.Equal(t, 2, q.len())
+}
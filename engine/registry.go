@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/nico612/crawler-go/collect"
+	"github.com/robertkrimen/otto"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// TaskRegistry 爬虫任务注册表，每个引擎持有自己的注册表，任何包都可以向注册表中注册任务。
+// 注册时会复制任务的规则表、规则、校验器列表、中间件列表和数据处理管道，注册后再修改原任务不影响已注册的任务，
+// 同一个任务注册到多个注册表中互不影响。处理器、校验器等本身仍然共用，有状态的处理器需要为每个注册表分别创建。
+type TaskRegistry struct {
+	mu   sync.RWMutex
+	list []*collect.Task
+	hash map[string]*collect.Task // 储存爬虫任务，k: 任务名
+}
+
+func NewTaskRegistry() *TaskRegistry {
+	return &TaskRegistry{
+		hash: make(map[string]*collect.Task),
+	}
+}
+
+// Add 注册静态规则任务，同名任务会被覆盖
+func (r *TaskRegistry) Add(task *collect.Task) {
+	r.add(copyTask(task))
+}
+
+// copyTask 复制任务，规则表、规则、校验器列表、中间件列表和数据处理管道重新分配
+func copyTask(task *collect.Task) *collect.Task {
+	t := *task
+	t.Validators = append([]collect.Validator(nil), task.Validators...)
+	t.Middlewares = append([]collect.Middleware(nil), task.Middlewares...)
+	t.Pipeline = task.Pipeline.Clone()
+	if task.Rule.Trunk != nil {
+		t.Rule.Trunk = make(map[string]*collect.Rule, len(task.Rule.Trunk))
+		for name, rule := range task.Rule.Trunk {
+			if rule == nil {
+				continue
+			}
+			rc := *rule
+			rc.ItemFields = append([]string(nil), rule.ItemFields...)
+			rc.Validators = append([]collect.Validator(nil), rule.Validators...)
+			t.Rule.Trunk[name] = &rc
+		}
+	}
+	return &t
+}
+
+func (r *TaskRegistry) add(task *collect.Task) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.hash[task.Name]; ok {
+		for i, t := range r.list {
+			if t.Name == task.Name {
+				r.list[i] = task
+			}
+		}
+	} else {
+		r.list = append(r.list, task)
+	}
+	r.hash[task.Name] = task
+}
+
+// Get 根据任务名返回任务，任务不存在时返回 nil
+func (r *TaskRegistry) Get(name string) *collect.Task {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.hash[name]
+}
+
+// List 按注册顺序返回所有任务
+func (r *TaskRegistry) List() []*collect.Task {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*collect.Task(nil), r.list...)
+}
+
+// ItemFields 返回任务中规则输出的数据字段，供储存创建表结构使用
+func (r *TaskRegistry) ItemFields(taskName string, ruleName string) []string {
+	task := r.Get(taskName)
+	if task == nil {
+		return nil
+	}
+	rule, ok := task.Rule.Trunk[ruleName]
+	if !ok {
+		return nil
+	}
+	return rule.ItemFields
+}
+
+// AddJSTask 注册动态规则任务，将 JS 脚本转换为任务的规则
+func (r *TaskRegistry) AddJSTask(m *collect.TaskModel) {
+	task := &collect.Task{
+		Property: m.Property,
+	}
+
+	task.Rule.Root = func() ([]*collect.Request, error) {
+		vm := otto.New() // js 虚拟机
+		vm.Set("AddJsReq", AddJsReqs)
+		v, err := vm.Eval(m.Root)
+		if err != nil {
+			return nil, err
+		}
+		e, err := v.Export()
+		if err != nil {
+			return nil, err
+		}
+		return e.([]*collect.Request), nil
+	}
+
+	for _, rm := range m.Rules {
+		paesrFunc := func(parse string) func(ctx *collect.Context) (collect.ParseResult, error) {
+			return func(ctx *collect.Context) (collect.ParseResult, error) {
+				vm := otto.New()
+				vm.Set("ctx", ctx)
+				v, err := vm.Eval(parse)
+				if err != nil {
+					return collect.ParseResult{}, err
+				}
+				e, err := v.Export()
+				if err != nil {
+					return collect.ParseResult{}, err
+				}
+				if e == nil {
+					return collect.ParseResult{}, err
+				}
+				return e.(collect.ParseResult), err
+			}
+		}(rm.ParseFunc)
+		if task.Rule.Trunk == nil {
+			task.Rule.Trunk = make(map[string]*collect.Rule, 0)
+		}
+		task.Rule.Trunk[rm.Name] = &collect.Rule{
+			ParseFunc: paesrFunc,
+		}
+	}
+
+	r.add(task)
+}
+
+// AddJsReqs 用于动态规则添加请求。
+// 除 Url、RuleName、Method、Priority 外，还支持 Query、Header、Form（对象，值为字符串或字符串数组）、
+// JSON（任意值）、Body（字符串）和 Timeout（毫秒）。
+func AddJsReqs(jreqs []map[string]interface{}) []*collect.Request {
+	reqs := make([]*collect.Request, 0)
+
+	for _, jreq := range jreqs {
+		req := &collect.Request{}
+		u, ok := jreq["Url"].(string)
+		if !ok {
+			return nil
+		}
+		req.Url = u
+		req.RuleName, _ = jreq["RuleName"].(string)
+		req.Method, _ = jreq["Method"].(string)
+		req.Priority = jsInt(jreq["Priority"])
+		req.Query = jsValues(jreq["Query"])
+		if h := jsValues(jreq["Header"]); h != nil {
+			req.Header = make(http.Header, len(h))
+			for k, vs := range h {
+				req.Header[http.CanonicalHeaderKey(k)] = vs
+			}
+		}
+		req.Form = jsValues(jreq["Form"])
+		req.JSON = jreq["JSON"]
+		if body, ok := jreq["Body"].(string); ok {
+			req.Body = []byte(body)
+		}
+		req.Timeout = time.Duration(jsInt(jreq["Timeout"])) * time.Millisecond
+		reqs = append(reqs, req)
+	}
+	return reqs
+}
+
+// jsInt 将 JS 导出的数字转换为 int64
+func jsInt(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+// jsValues 将 JS 对象转换为 url.Values，对象的值可以是字符串、数字或它们的数组
+func jsValues(v interface{}) url.Values {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	values := make(url.Values, len(m))
+	for k, val := range m {
+		rv := reflect.ValueOf(val)
+		if rv.Kind() != reflect.Slice {
+			values.Add(k, fmt.Sprint(val))
+			continue
+		}
+		for i := 0; i < rv.Len(); i++ {
+			values.Add(k, fmt.Sprint(rv.Index(i).Interface()))
+		}
+	}
+	return values
+}
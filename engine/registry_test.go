@@ -0,0 +1,36 @@
+package engine_test
+
+import (
+	"testing"
+
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/engine"
+	"github.com/nico612/crawler-go/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryAddCopiesTask(t *testing.T) {
+	task := listTask("copy", 1)
+	task.Validators = []collect.Validator{collect.MinSize(1)}
+	task.Pipeline = pipeline.New(pipeline.TrimSpace())
+
+	a, b := engine.NewTaskRegistry(), engine.NewTaskRegistry()
+	a.Add(task)
+	b.Add(task)
+
+	// 注册后修改原任务，不影响已注册的任务
+	task.Rule.Trunk["extra"] = &collect.Rule{}
+	task.Rule.Trunk["list"].ItemFields = []string{"title"}
+	task.Validators = append(task.Validators, collect.MinSize(2))
+	task.Pipeline.Use(pipeline.Required("title"))
+
+	for _, r := range []*engine.TaskRegistry{a, b} {
+		got := r.Get("copy")
+		assert.NotContains(t, got.Rule.Trunk, "extra")
+		assert.Empty(t, got.Rule.Trunk["list"].ItemFields)
+		assert.Len(t, got.Validators, 1)
+		assert.Len(t, got.Pipeline.Stats(), 1)
+	}
+	a.Get("copy").Rule.Trunk["list"].ItemFields = []string{"a"}
+	assert.Empty(t, b.Get("copy").Rule.Trunk["list"].ItemFields)
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/pipeline"
+	"github.com/nico612/crawler-go/storage"
+	"go.uber.org/zap"
+	"hash/fnv"
+	"time"
+)
+
+// 结果处理
+// 多个结果处理协程并发处理解析结果，避免一次较慢的储存阻塞所有 worker。
+// 设置了 OrderedResults 的任务的结果总是交给同一个协程，按交付的顺序依次处理。
+
+// parseOutput 请求的解析结果
+type parseOutput struct {
+	req    *collect.Request
+	result collect.ParseResult
+	page   *collect.PageState // 增量抓取的页面状态，结果全部处理成功后记录
+}
+
+// sendResult 将解析结果交给结果处理协程，引擎停止后丢弃结果
+func (c *Crawler) sendResult(out *parseOutput) {
+	ch := c.out
+	if out.req.Task.OrderedResults {
+		h := fnv.New32a()
+		h.Write([]byte(out.req.Task.Name))
+		ch = c.outs[h.Sum32()%uint32(len(c.outs))]
+	}
+	select {
+	case ch <- out:
+	case <-c.stop:
+		c.Logger.Warn("crawler stopped, drop result", zap.String("url", out.req.Url))
+		// 结果没有储存，不通知调度器，持久化调度器下次启动时重新抓取
+		c.tracker.finish(out.req, resultFetched)
+	}
+}
+
+// HandleResult 处理共用通道和 own 中的解析结果，引擎停止时排空通道中剩余的结果后返回
+func (c *Crawler) HandleResult(own <-chan *parseOutput) {
+	for {
+		select {
+		case out := <-c.out:
+			c.safeHandleResult(out)
+		case out := <-own:
+			c.safeHandleResult(out)
+		case <-c.stop:
+			for {
+				select {
+				case out := <-c.out:
+					c.safeHandleResult(out)
+				case out := <-own:
+					c.safeHandleResult(out)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// handleResult 解析得到的数据经过数据处理管道后储存
+func (c *Crawler) handleResult(out *parseOutput) {
+	defer c.finish(out.req, resultFetched)
+	task := out.req.Task
+	c.tracker.update(task, func(s *TaskSummary) {
+		s.Items += int64(len(out.result.Items))
+	})
+	c.consume(task, 0, len(out.result.Items))
+	var dropped, saved, failed int64
+	var processFailed bool
+	for _, item := range out.result.Items {
+		d, ok := item.(*storage.DataCell)
+		if !ok {
+			c.Logger.Debug("get result", zap.Any("item", item))
+			continue
+		}
+		if err := c.processItem(task, d); err != nil {
+			dropped++
+			if pipeline.IsDrop(err) {
+				c.Logger.Debug("item dropped", zap.Error(err), zap.String("url", out.req.Url))
+			} else {
+				processFailed = true
+				c.Logger.Error("process item failed", zap.Error(err), zap.String("url", out.req.Url))
+			}
+			continue
+		}
+		if task.Storage == nil {
+			c.Logger.Debug("get result", zap.Any("item", d.Data))
+			continue
+		}
+		if err := c.save(task.Storage, d); err != nil {
+			failed++
+			c.Logger.Error("save item failed",
+				zap.Error(err),
+				zap.String("task", task.Name),
+				zap.String("rule", out.req.RuleName),
+				zap.String("url", out.req.Url),
+				zap.Any("item", d.Data["Data"]),
+			)
+			continue
+		}
+		saved++
+	}
+	c.tracker.update(task, func(s *TaskSummary) {
+		s.Dropped += dropped
+		s.Saved += saved
+		s.SaveFailed += failed
+	})
+	// 有数据处理或储存失败时不记录页面状态，下次抓取时重新解析
+	if failed == 0 && !processFailed {
+		c.savePageState(out.req, out.page)
+	}
+}
+
+// processItem 依次执行引擎和任务的数据处理管道
+func (c *Crawler) processItem(task *collect.Task, item *storage.DataCell) error {
+	if err := c.Pipeline.Process(item); err != nil {
+		return err
+	}
+	return task.Pipeline.Process(item)
+}
+
+// save 储存数据，失败时按 SaveRetry 重试，每次重试的间隔依次增加 SaveRetryDelay
+func (c *Crawler) save(s storage.Storage, item *storage.DataCell) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = s.Save(item); err == nil {
+			return nil
+		}
+		if attempt >= c.SaveRetry {
+			return err
+		}
+		c.Logger.Warn("save item failed, retry",
+			zap.Error(err),
+			zap.Int("attempt", attempt),
+		)
+		time.Sleep(time.Duration(attempt) * c.SaveRetryDelay)
+	}
+}
+
+// PipelineStats 返回引擎数据处理管道中各个处理器的统计
+func (c *Crawler) PipelineStats() []pipeline.Stats {
+	return c.Pipeline.Stats()
+}
@@ -1,120 +1,44 @@
 package engine
 
 import (
+	"context"
+	"errors"
 	"github.com/nico612/crawler-go/collect"
-	"github.com/nico612/crawler-go/parse/doubanbook"
-	"github.com/nico612/crawler-go/parse/doubangroup"
-	"github.com/nico612/crawler-go/parse/doubangroupjs"
+	"github.com/nico612/crawler-go/cron"
+	"github.com/nico612/crawler-go/dedup"
+	"github.com/nico612/crawler-go/session"
 	"github.com/nico612/crawler-go/storage"
-	"github.com/robertkrimen/otto"
 	"go.uber.org/zap"
-	"runtime/debug"
+	"io"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-func init() {
-	Store.Add(doubangroup.DoubangroupTask)
-	Store.Add(doubanbook.DoubanBookTask)
-	Store.AddJSTask(doubangroupjs.DoubangroupJSTask)
-}
-
-// Store 全局爬虫任务实例
-var Store = &CrawlerStore{
-	list: []*collect.Task{},
-	Hash: map[string]*collect.Task{},
-}
-
-type CrawlerStore struct {
-	list []*collect.Task
-	Hash map[string]*collect.Task // 储存爬虫任务，k: 任务名
-}
-
-func GetFields(taskName string, ruleName string) []string {
-	return Store.Hash[taskName].Rule.Trunk[ruleName].ItemFields
-}
-
-func (c *CrawlerStore) Add(task *collect.Task) {
-	c.Hash[task.Name] = task
-	c.list = append(c.list, task)
-}
-
-func (c *CrawlerStore) AddJSTask(m *collect.TaskModel) {
-	task := &collect.Task{
-		Property: m.Property,
-	}
-
-	task.Rule.Root = func() ([]*collect.Request, error) {
-		vm := otto.New() // js 虚拟机
-		vm.Set("AddJsReq", AddJsReqs)
-		v, err := vm.Eval(m.Root)
-		if err != nil {
-			return nil, err
-		}
-		e, err := v.Export()
-		if err != nil {
-			return nil, err
-		}
-		return e.([]*collect.Request), nil
-	}
-
-	for _, r := range m.Rules {
-		paesrFunc := func(parse string) func(ctx *collect.Context) (collect.ParseResult, error) {
-			return func(ctx *collect.Context) (collect.ParseResult, error) {
-				vm := otto.New()
-				vm.Set("ctx", ctx)
-				v, err := vm.Eval(parse)
-				if err != nil {
-					return collect.ParseResult{}, err
-				}
-				e, err := v.Export()
-				if err != nil {
-					return collect.ParseResult{}, err
-				}
-				if e == nil {
-					return collect.ParseResult{}, err
-				}
-				return e.(collect.ParseResult), err
-			}
-		}(r.ParseFunc)
-		if task.Rule.Trunk == nil {
-			task.Rule.Trunk = make(map[string]*collect.Rule, 0)
-		}
-		task.Rule.Trunk[r.Name] = &collect.Rule{
-			ParseFunc: paesrFunc,
-		}
-	}
-
-	c.Hash[task.Name] = task
-	c.list = append(c.list, task)
-}
+// Crawler 爬虫引擎
+type Crawler struct {
+	out    chan *parseOutput   // 解析结果，由任意一个结果处理协程处理
+	outs   []chan *parseOutput // 每个结果处理协程单独的通道，用于要求有序处理的任务
+	stop   chan struct{}       // 关闭后结果处理协程排空通道并退出
+	cancel context.CancelFunc  // 所有任务完成后停止引擎
 
-// AddJsReqs 用于动态规则添加请求。
-func AddJsReqs(jreqs []map[string]interface{}) []*collect.Request {
-	reqs := make([]*collect.Request, 0)
+	tracker     *tracker // 记录任务的完成情况
+	workers     workerPool
+	workerStats WorkerStats
+	busy        int64      // 正在处理请求的 worker 数
+	retrying    int64      // 等待延迟重试、还未推入调度器的请求数
+	fetchStats  fetchStats // 自适应调整 worker 数量使用的抓取统计
+	periodic    bool       // 是否有周期执行的任务
 
-	for _, jreq := range jreqs {
-		req := &collect.Request{}
-		u, ok := jreq["Url"].(string)
-		if !ok {
-			return nil
-		}
-		req.Url = u
-		req.RuleName, _ = jreq["RuleName"].(string)
-		req.Method, _ = jreq["Method"].(string)
-		req.Priority, _ = jreq["Priority"].(int64)
-		reqs = append(reqs, req)
-	}
-	return reqs
-}
+	runs     map[string]*taskRun // 任务最近一次的运行，k: 任务名
+	taskLock sync.RWMutex
 
-// Crawler 爬虫引擎
-type Crawler struct {
-	out         chan collect.ParseResult
-	Visited     map[string]bool
-	VisitedLock sync.Mutex
+	runVisited map[*collect.Task]dedup.Deduper // 周期任务每次运行的去重记录，运行完成后删除
+	visitLock  sync.Mutex
 
-	failures    map[string]*collect.Request // 失败请求id -> 失败请求
-	failureLock sync.Mutex
+	sessions    map[string]*session.Pool // 任务的会话池，k: 任务名
+	logins      map[string]*loginState   // 会话的登录状态，k: 任务名/会话名
+	sessionLock sync.Mutex
 
 	options
 }
@@ -125,231 +49,717 @@ func NewEngine(opts ...Option) *Crawler {
 		opt(&options)
 	}
 	e := &Crawler{}
-	e.Visited = make(map[string]bool, 100)
-	e.out = make(chan collect.ParseResult)
-	e.failures = make(map[string]*collect.Request)
+	if options.ResultWorkers < 1 {
+		options.ResultWorkers = 1
+	}
+	e.out = make(chan *parseOutput, options.ResultBuffer)
+	e.outs = make([]chan *parseOutput, options.ResultWorkers)
+	for i := range e.outs {
+		e.outs[i] = make(chan *parseOutput, options.ResultBuffer)
+	}
+	e.stop = make(chan struct{})
+	e.tracker = newTracker(func(task *collect.Task, summary TaskSummary) {
+		e.Logger.Info("task done",
+			zap.String("task", summary.Name),
+			zap.Duration("duration", summary.End.Sub(summary.Start)),
+			zap.Int64("fetched", summary.Fetched),
+			zap.Int64("failed", summary.Failed),
+			zap.Int64("skipped", summary.Skipped),
+			zap.Int64("unchanged", summary.Unchanged),
+			zap.Int64("items", summary.Items),
+			zap.Int64("dropped", summary.Dropped),
+			zap.Int64("saved", summary.Saved),
+			zap.Int64("save_failed", summary.SaveFailed),
+			zap.String("stop_reason", summary.StopReason),
+		)
+		e.taskDone(task)
+		if options.OnTaskDone != nil {
+			options.OnTaskDone(summary)
+		}
+	}, func(summaries []TaskSummary) {
+		e.Logger.Info("all tasks done", zap.Int("tasks", len(summaries)))
+		if options.OnDone != nil {
+			options.OnDone(summaries)
+		}
+		// 有周期任务时引擎需要继续运行
+		if options.StopWhenDone && !e.periodic && e.cancel != nil {
+			e.cancel()
+		}
+	})
+	if n, ok := options.scheduler.(DropNotifier); ok {
+		n.OnDrop(func(req *collect.Request) {
+			e.finish(req, resultSkipped)
+		})
+	}
+	e.runs = make(map[string]*taskRun)
+	e.runVisited = make(map[*collect.Task]dedup.Deduper)
+	e.sessions = make(map[string]*session.Pool)
+	e.logins = make(map[string]*loginState)
+	if options.Deduper == nil {
+		options.Deduper = dedup.NewMapDeduper()
+	}
+	if options.DeadLetter == nil {
+		options.DeadLetter = NewMemoryDeadLetter()
+	}
+	if options.PageCache == nil {
+		options.PageCache = collect.NewMemoryPageCache()
+	}
+	if options.Registry == nil {
+		options.Registry = NewTaskRegistry()
+	}
 	e.options = options
 	return e
 }
 
-// Schedule 任务调度分配
-func (c *Crawler) Schedule() {
-	var reqs []*collect.Request
+// Schedule 任务调度分配，启动 Seeds 中的任务
+func (c *Crawler) Schedule(ctx context.Context) {
+	runs := make(map[string]*taskRun, len(c.Seeds))
 	for _, seed := range c.Seeds {
-		task := Store.Hash[seed.Name]
-		task.Fetcher = seed.Fetcher
-		task.Storage = seed.Storage
-		task.Limit = seed.Limit
-		task.Logger = c.Logger
-		rootreqs, err := task.Rule.Root()
+		run := c.newRun(seed.Name)
+		if run == nil {
+			c.Logger.Error("task not registered", zap.String("task", seed.Name))
+			continue
+		}
+		runs[seed.Name] = run
+	}
+	c.taskLock.Lock()
+	for name, run := range runs {
+		c.runs[name] = run
+	}
+	c.taskLock.Unlock()
+
+	// 恢复上次未完成的请求，已恢复的任务不再从根节点开始
+	var reqs []*collect.Request
+	restored := make(map[string]bool)
+	if r, ok := c.scheduler.(Restorer); ok {
+		rreqs, err := r.Restore(func(name string) *collect.Task {
+			if run, ok := runs[name]; ok {
+				return run.task
+			}
+			return nil
+		})
+		if err != nil {
+			c.Logger.Error("restore requests failed", zap.Error(err))
+		}
+		for _, req := range rreqs {
+			restored[req.Task.Name] = true
+			// 上次取出后没有处理完的请求可能已经记录为访问过
+			c.forget(req)
+		}
+		c.Logger.Info("restore requests", zap.Int("count", len(rreqs)))
+		reqs = append(reqs, rreqs...)
+	}
+
+	tasks := make([]*collect.Task, 0, len(runs))
+	for _, run := range runs {
+		tasks = append(tasks, run.task)
+		if restored[run.task.Name] {
+			continue
+		}
+		rootreqs, err := c.rootRequests(run.task)
 		if err != nil {
 			c.Logger.Error("get root failed",
+				zap.String("task", run.task.Name),
 				zap.Error(err),
 			)
 			continue
 		}
-		for _, req := range rootreqs {
-			req.Task = task
-		}
 		reqs = append(reqs, rootreqs...)
 	}
 
-	go c.scheduler.Schedule()
+	for _, run := range runs {
+		if run.task.Cron == "" {
+			continue
+		}
+		sched, err := cron.Parse(run.task.Cron)
+		if err != nil {
+			c.Logger.Error("parse task cron failed", zap.String("task", run.task.Name), zap.Error(err))
+			continue
+		}
+		c.periodic = true
+		go c.runPeriodic(ctx, run.task.Name, sched)
+	}
+
+	c.tracker.register(tasks...)
+	c.tracker.add(reqs...)
+	for _, run := range runs {
+		c.startBudget(run)
+	}
+	for _, task := range tasks {
+		c.tracker.start(task)
+	}
+
+	go c.scheduler.Schedule(ctx)
 	go c.scheduler.Push(reqs...)
 }
 
-func (c *Crawler) Run() {
-	go c.Schedule()
-	for i := 0; i < c.WorkCount; i++ {
-		go c.CreateWork()
+// push 推入请求并记录到任务未处理完的请求中
+func (c *Crawler) push(reqs ...*collect.Request) {
+	c.tracker.add(reqs...)
+	c.scheduler.Push(reqs...)
+}
+
+// finish 请求处理结束，通知调度器并更新任务的统计
+func (c *Crawler) finish(req *collect.Request, result requestResult) {
+	if cp, ok := c.scheduler.(Completer); ok {
+		cp.Complete(req)
 	}
-	c.HandleResult()
+	c.tracker.finish(req, result)
 }
 
-func (c *Crawler) CreateWork() {
+// Summary 返回任务最近一次运行的执行统计
+func (c *Crawler) Summary(name string) (TaskSummary, bool) {
+	c.taskLock.RLock()
+	run, ok := c.runs[name]
+	c.taskLock.RUnlock()
+	if !ok {
+		return TaskSummary{}, false
+	}
+	return c.tracker.summary(run.task)
+}
 
-	defer func() {
-		if err := recover(); err != nil {
-			c.Logger.Error("worker panic",
-				zap.Any("err", err),
-				zap.String("stack", string(debug.Stack())))
-		}
-	}()
+// Runs 按启动顺序返回任务每次运行的执行统计，每个任务最多保留最近 100 次已完成的运行
+func (c *Crawler) Runs(name string) []TaskSummary {
+	return c.tracker.runs(name)
+}
 
-	for {
-		// 取出一个任务
-		req := c.scheduler.Pull()
-		// 检查任务深度
-		if err := req.Check(); err != nil {
-			c.Logger.Error("check failed", zap.Error(err))
-			continue
+// Summaries 按启动顺序返回所有任务每次运行的执行统计
+func (c *Crawler) Summaries() []TaskSummary {
+	return c.tracker.summaries()
+}
+
+// Run 启动爬虫引擎，阻塞直到 ctx 被取消，设置了 StopWhenDone 时所有任务完成后也会返回。
+// ctx 取消后不再拉取新的请求，等待正在执行的请求在 ShutdownTimeout 内完成，
+// 处理完剩余的结果并刷新储存后返回。
+func (c *Crawler) Run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c.cancel = cancel
+
+	go c.Schedule(ctx)
+
+	c.startWorkers()
+	if c.MaxWorkers > 0 {
+		go c.adapt(ctx)
+	}
+
+	var resultWg sync.WaitGroup
+	for _, own := range c.outs {
+		resultWg.Add(1)
+		go func(own chan *parseOutput) {
+			defer resultWg.Done()
+			c.HandleResult(own)
+		}(own)
+	}
+
+	<-ctx.Done()
+	c.Logger.Info("crawler shutting down")
+
+	workerDone := c.stopWorkers()
+	select {
+	case <-workerDone:
+	case <-time.After(c.ShutdownTimeout):
+		c.Logger.Warn("shutdown timeout, abandon in-flight requests",
+			zap.Duration("timeout", c.ShutdownTimeout),
+		)
+	}
+
+	close(c.stop)
+	resultWg.Wait()
+	c.flush()
+	c.saveSessions()
+	if cl, ok := c.scheduler.(io.Closer); ok {
+		if err := cl.Close(); err != nil {
+			c.Logger.Error("close scheduler failed", zap.Error(err))
 		}
-		// 任务已经爬取，跳过
-		if !req.Task.Reload && c.HasVisited(req) {
-			c.Logger.Debug("request has visited", zap.String("url:", req.Url))
-			continue
+	}
+	if cl, ok := c.Deduper.(io.Closer); ok {
+		if err := cl.Close(); err != nil {
+			c.Logger.Error("close deduper failed", zap.Error(err))
+		}
+	}
+	if cl, ok := c.DeadLetter.(io.Closer); ok {
+		if err := cl.Close(); err != nil {
+			c.Logger.Error("close dead letter failed", zap.Error(err))
+		}
+	}
+	if cl, ok := c.PageCache.(io.Closer); ok {
+		if err := cl.Close(); err != nil {
+			c.Logger.Error("close page cache failed", zap.Error(err))
 		}
+	}
+	c.Logger.Info("crawler stopped")
+}
 
-		c.StoreVisited(req)
+// process 处理一个请求：抓取、校验、解析，并将解析结果交给结果处理协程
+func (c *Crawler) process(req *collect.Request) {
+	// 检查任务深度
+	if err := req.Check(); err != nil {
+		c.Logger.Error("check failed", zap.Error(err))
+		c.finish(req, resultSkipped)
+		return
+	}
+	// 任务已经爬取，跳过
+	if !req.Task.Reload && c.HasVisited(req) {
+		c.Logger.Debug("request has visited", zap.String("url:", req.Url))
+		c.finish(req, resultSkipped)
+		return
+	}
 
-		body, err := req.Fetch()
-		if err != nil {
-			c.Logger.Error("can't fetch ", zap.Error(err), zap.String("url", req.Url))
-			c.SetFailure(req)
-			continue
-		}
+	c.StoreVisited(req)
 
-		if len(body) < 6000 {
-			c.Logger.Error("can't fetch ",
-				zap.Int("length", len(body)),
-				zap.String("url", req.Url),
-			)
-			c.SetFailure(req)
+	// 超出预算，删除访问记录，之后的运行或预算调整后仍可以抓取
+	if !c.reserve(req) {
+		c.forget(req)
+		c.finish(req, resultSkipped)
+		return
+	}
 
-			continue
+	chain := collect.Chain(req.Task.Middlewares)
+	if err := chain.BeforeFetch(req); err != nil {
+		c.middlewareFailed(req, err)
+		return
+	}
+
+	start := time.Now()
+	resp, err := c.fetch(req)
+	if err == nil && req.Task.Login.Enabled() && req.Task.Sessions != nil && req.Task.Login.Expired(resp) {
+		c.sessionExpired(req, start)
+		return
+	}
+	if err == nil {
+		c.consume(req.Task, len(resp.Body), 0)
+	}
+	if err == nil && req.NotModified(resp) {
+		c.Logger.Debug("page not modified", zap.String("url", req.Url))
+		c.finish(req, resultUnchanged)
+		return
+	}
+	if err == nil {
+		if err = req.Validate(resp); err != nil {
+			c.fetchFailed()
 		}
+	}
+	if err == nil {
+		err = chain.AfterFetch(req, resp)
+	}
+	if errors.Is(err, collect.ErrSkip) {
+		c.middlewareFailed(req, err)
+		return
+	}
+	if err != nil && req.Task.StatusPolicy == collect.StatusSkip && collect.FailureKindOf(err) == collect.FailureStatus {
+		c.Logger.Debug("skip status", zap.Error(err), zap.String("url", req.Url))
+		c.finish(req, resultSkipped)
+		return
+	}
+	if err != nil {
+		c.Logger.Error("can't fetch ",
+			zap.Error(err),
+			zap.String("kind", string(collect.FailureKindOf(err))),
+			zap.String("url", req.Url),
+		)
+		c.SetFailure(req, err)
+		return
+	}
 
-		rule := req.Task.Rule.Trunk[req.RuleName]
-		result, err := rule.ParseFunc(&collect.Context{
-			body,
-			req,
-		})
+	page, unchanged := req.Unchanged(resp)
+	if unchanged {
+		c.Logger.Debug("page content unchanged", zap.String("url", req.Url))
+		c.savePageState(req, page)
+		c.finish(req, resultUnchanged)
+		return
+	}
 
-		if err != nil {
-			c.Logger.Error("ParseFunc failed ",
-				zap.Error(err),
-				zap.String("url", req.Url),
-			)
-			continue
-		}
+	rule := req.Task.Rule.Trunk[req.RuleName]
+	result, err := rule.ParseFunc(&collect.Context{
+		Body: resp.Body,
+		Req:  req,
+		Resp: resp,
+	})
+	if err == nil {
+		err = chain.AfterParse(req, &result)
+	}
+	if errors.Is(err, collect.ErrSkip) {
+		c.middlewareFailed(req, err)
+		return
+	}
+	if err != nil {
+		c.Logger.Error("ParseFunc failed ",
+			zap.Error(err),
+			zap.String("url", req.Url),
+		)
+		c.SetFailure(req, err)
+		return
+	}
 
-		if len(result.Requesrts) > 0 {
-			go c.scheduler.Push(result.Requesrts...)
-		}
+	if len(result.Requesrts) > 0 {
+		// 队列已满时阻塞当前 worker，减慢解析新页面的速度
+		c.push(result.Requesrts...)
+	}
 
-		c.out <- result
+	c.sendResult(&parseOutput{req: req, result: result, page: page})
+}
+
+// savePageState 记录增量抓取的页面状态
+func (c *Crawler) savePageState(req *collect.Request, page *collect.PageState) {
+	if err := req.SavePageState(page); err != nil {
+		c.Logger.Error("save page state failed", zap.Error(err), zap.String("url", req.Url))
 	}
 }
 
-func (c *Crawler) HandleResult() {
-	for {
-		select {
-		case result := <-c.out:
-			for _, item := range result.Items {
-				switch d := item.(type) {
-				case *storage.DataCell:
-					name := d.GetTaskName()
-					task := Store.Hash[name]
-					task.Storage.Save(d)
-				}
-				c.Logger.Sugar().Info("get result: ", item)
-			}
+// middlewareFailed 处理中间件返回的错误，ErrSkip 跳过请求，其他错误按请求失败处理
+func (c *Crawler) middlewareFailed(req *collect.Request, err error) {
+	if errors.Is(err, collect.ErrSkip) {
+		c.Logger.Debug("request skipped by middleware", zap.String("url", req.Url), zap.Error(err))
+		c.finish(req, resultSkipped)
+		return
+	}
+	c.Logger.Error("middleware failed", zap.Error(err), zap.String("url", req.Url))
+	c.SetFailure(req, err)
+}
+
+// flush 刷新所有任务储存中缓存的数据
+func (c *Crawler) flush() {
+	c.taskLock.RLock()
+	defer c.taskLock.RUnlock()
+	for _, run := range c.runs {
+		task := run.task
+		if task.Storage == nil {
+			continue
+		}
+		f, ok := task.Storage.(storage.Flusher)
+		if !ok {
+			continue
+		}
+		if err := f.Flush(); err != nil {
+			c.Logger.Error("flush storage failed",
+				zap.String("task", task.Name),
+				zap.Error(err),
+			)
 		}
 	}
 }
 
 // StoreVisited 储存已处理过的任务
 func (c *Crawler) StoreVisited(reqs ...*collect.Request) {
-	c.VisitedLock.Lock()
-	defer c.VisitedLock.Unlock()
-
 	for _, r := range reqs {
-		unique := r.Unique()
-		c.Visited[unique] = true
+		if err := c.deduper(r.Task).Add(r.Unique()); err != nil {
+			c.Logger.Error("store visited failed", zap.Error(err), zap.String("url", r.Url))
+		}
 	}
 }
 
 func (c *Crawler) HasVisited(r *collect.Request) bool {
-	c.VisitedLock.Lock()
-	defer c.VisitedLock.Unlock()
-	unique := r.Unique()
-	return c.Visited[unique]
+	return c.deduper(r.Task).Has(r.Unique())
 }
 
-func (c *Crawler) SetFailure(req *collect.Request) {
-	if !req.Task.Reload {
-		c.VisitedLock.Lock()
-		unique := req.Unique()
-		delete(c.Visited, unique)
-		c.VisitedLock.Unlock()
+// deduper 返回任务使用的去重记录。
+// 周期任务的每次运行分别去重，使用单独的内存去重记录，运行完成后删除，避免去重记录随运行次数无限增长。
+func (c *Crawler) deduper(task *collect.Task) dedup.Deduper {
+	if task.RunID == "" {
+		return c.Deduper
 	}
-	c.failureLock.Lock()
-	defer c.failureLock.Unlock()
-	if _, ok := c.failures[req.Unique()]; !ok {
-		// 首次失败时，再重新执行一次
-		c.failures[req.Unique()] = req
-		c.scheduler.Push(req)
+	c.visitLock.Lock()
+	defer c.visitLock.Unlock()
+	d, ok := c.runVisited[task]
+	if !ok {
+		d = dedup.NewMapDeduper()
+		c.runVisited[task] = d
 	}
-	// todo: 失败2次，加载到失败队列中
+	return d
 }
 
 type Scheduler interface {
-	Schedule()
+	// Schedule 启动调度，ctx 取消后调度器停止
+	Schedule(ctx context.Context)
+	// Push 推入任务，调度器停止后直接返回
 	Push(...*collect.Request)
+	// Pull 取出一个任务，调度器停止后返回 nil
 	Pull() *collect.Request
 }
 
-// Schedule 调度器
+// DropNotifier 可能主动丢弃请求的调度器，丢弃请求时调用注册的函数
+type DropNotifier interface {
+	OnDrop(func(req *collect.Request))
+}
+
+// SpillNotifier 可能将请求溢写到磁盘的调度器。
+// 溢写后内存中不再保留原来的请求，读回时创建新的请求，溢写和读回都按先进先出的顺序回调
+type SpillNotifier interface {
+	OnSpill(spilled, unspilled func(req *collect.Request))
+}
+
+// Completer 需要知道请求何时处理结束的调度器。
+// 请求处理结束（解析结果已处理、被跳过、被丢弃或永久失败）时调用 Complete，等待重试的请求不算处理结束。
+type Completer interface {
+	Complete(req *collect.Request)
+}
+
+// Schedule 调度器，按请求的优先级分发任务，优先级越大越先处理，相同优先级时各任务轮流分发，同一任务内按遍历策略排序
 type Schedule struct {
-	requestCh   chan *collect.Request // 任务通道
-	workerCh    chan *collect.Request // 任务处理通道
-	priReqQueue []*collect.Request    // 储存优先任务队列
-	reqQueue    []*collect.Request    // 储存普通任务队列
-	Logger      *zap.Logger
+	requestCh chan *collect.Request // 任务通道
+	workerCh  chan *collect.Request // 任务处理通道
+	done      chan struct{}         // 调度停止通知
+	queue     requestQueue          // 优先级任务队列
+	Logger    *zap.Logger
+
+	scheduleOptions
+	depthLock sync.Mutex
+	depth     map[int64]int // 各优先级区间的队列深度
+
+	onDrop    func(req *collect.Request)
+	onSpill   func(req *collect.Request)
+	onUnspill func(req *collect.Request)
+	spill     *spillFile      // 溢写文件
+	spilled   []*collect.Task // 溢写的请求所属的任务，按溢写的顺序排列
+	stats     QueueStats
+}
+
+// QueueStats 队列统计
+type QueueStats struct {
+	Dropped int64 // 因队列已满丢弃的请求数
+	Spilled int64 // 溢写到磁盘的请求数
+	OnDisk  int64 // 当前仍在磁盘中的请求数
 }
 
-func NewSchedule() *Schedule {
+func NewSchedule(opts ...ScheduleOption) *Schedule {
+	options := defaultScheduleOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
 	s := &Schedule{}
+	s.scheduleOptions = options
 	s.requestCh = make(chan *collect.Request)
 	s.workerCh = make(chan *collect.Request)
+	s.done = make(chan struct{})
+	s.queue.aging = options.aging
+	s.depth = make(map[int64]int)
+	s.Logger = zap.NewNop()
 	return s
 }
 
 // Schedule 任务调度，负责接收任务，并将任务发送到 worker 通道中
-func (s *Schedule) Schedule() {
-	var req *collect.Request
-	var ch chan *collect.Request
-
+func (s *Schedule) Schedule(ctx context.Context) {
 	go func() {
+		defer close(s.done)
+		defer func() {
+			if s.spill != nil {
+				s.spill.close()
+			}
+		}()
+
+		var agingC <-chan time.Time
+		if s.aging > 0 {
+			ticker := time.NewTicker(s.aging)
+			defer ticker.Stop()
+			agingC = ticker.C
+		}
+
 		for {
-			// 优先任务
-			if req == nil && len(s.priReqQueue) > 0 {
-				req = s.priReqQueue[0]
-				s.priReqQueue = s.priReqQueue[1:]
+			s.unspill()
+
+			// 堆顶的任务只有成功发送后才会出队，保证新推入的高优先级任务可以插队
+			var req *collect.Request
+			var ch chan *collect.Request
+			if s.queue.len() > 0 {
+				req = s.queue.peek()
 				ch = s.workerCh
 			}
 
-			// 普通任务
-			if req == nil && len(s.reqQueue) > 0 {
-				req = s.reqQueue[0]
-				s.reqQueue = s.reqQueue[1:]
-				ch = s.workerCh
+			// 阻塞策略下队列已满时不再接收任务，Push 会阻塞
+			requestCh := s.requestCh
+			if s.full() && s.fullPolicy == FullBlock {
+				requestCh = nil
 			}
 
 			select {
-			case r := <-s.requestCh:
-				if r.Priority > 0 {
-					s.priReqQueue = append(s.priReqQueue, r)
-				} else {
-					s.reqQueue = append(s.reqQueue, r)
-				}
-			case ch <- req: // 将任务发送到 workerCh 通道，如果ch 为nil 或者 req 为nil 则该协程会阻塞
-				req = nil
-				ch = nil
+			case r := <-requestCh:
+				s.push(r)
+			case ch <- req: // 将任务发送到 workerCh 通道，如果ch 为nil 则该协程会阻塞
+				s.queue.pop()
+				s.addDepth(req, -1)
+			case now := <-agingC:
+				s.queue.age(now)
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
 }
 
+func (s *Schedule) full() bool {
+	return s.queueSize > 0 && s.queue.len() >= s.queueSize
+}
+
+func (s *Schedule) push(req *collect.Request) {
+	s.queue.push(req, time.Now())
+	s.addDepth(req, 1)
+	if s.queueSize <= 0 || s.queue.len() <= s.queueSize {
+		return
+	}
+
+	lowest := s.queue.removeLowest()
+	s.addDepth(lowest, -1)
+	if s.fullPolicy == FullSpill {
+		err := s.spillRequest(lowest)
+		if err == nil {
+			return
+		}
+		s.Logger.Error("spill request failed", zap.Error(err), zap.String("url", lowest.Url))
+	}
+	s.drop(lowest)
+}
+
+func (s *Schedule) drop(req *collect.Request) {
+	atomic.AddInt64(&s.stats.Dropped, 1)
+	s.Logger.Warn("queue is full, drop request",
+		zap.String("url", req.Url),
+		zap.Int64("priority", req.Priority),
+	)
+	if s.onDrop != nil {
+		s.onDrop(req)
+	}
+}
+
+// OnDrop 注册请求被丢弃时的回调，需要在 Schedule 之前调用
+func (s *Schedule) OnDrop(f func(req *collect.Request)) {
+	s.onDrop = f
+}
+
+// OnSpill 注册请求溢写和读回时的回调，需要在 Schedule 之前调用
+func (s *Schedule) OnSpill(spilled, unspilled func(req *collect.Request)) {
+	s.onSpill = spilled
+	s.onUnspill = unspilled
+}
+
+func (s *Schedule) spillRequest(req *collect.Request) error {
+	if s.spill == nil {
+		f, err := newSpillFile(s.spillDir)
+		if err != nil {
+			return err
+		}
+		s.spill = f
+	}
+	if err := s.spill.write(req.Record()); err != nil {
+		return err
+	}
+	// 内存中只保留所属的任务，同名任务的多次运行读回后仍属于原来的那次运行
+	s.spilled = append(s.spilled, req.Task)
+	if s.onSpill != nil {
+		s.onSpill(req)
+	}
+	atomic.AddInt64(&s.stats.Spilled, 1)
+	atomic.AddInt64(&s.stats.OnDisk, 1)
+	return nil
+}
+
+// unspill 队列有空位时从溢写文件中读回请求
+func (s *Schedule) unspill() {
+	for len(s.spilled) > 0 && !s.full() {
+		task := s.spilled[0]
+		s.spilled[0] = nil
+		s.spilled = s.spilled[1:]
+		if len(s.spilled) == 0 {
+			s.spilled = nil
+		}
+		rec, err := s.spill.read()
+		atomic.AddInt64(&s.stats.OnDisk, -1)
+		req := rec.Request(task)
+		if s.onUnspill != nil {
+			s.onUnspill(req)
+		}
+		if err != nil {
+			s.Logger.Error("read spilled request failed", zap.Error(err))
+			s.drop(req)
+			continue
+		}
+		s.queue.push(req, time.Now())
+		s.addDepth(req, 1)
+	}
+}
+
+// Stats 返回队列统计
+func (s *Schedule) Stats() QueueStats {
+	return QueueStats{
+		Dropped: atomic.LoadInt64(&s.stats.Dropped),
+		Spilled: atomic.LoadInt64(&s.stats.Spilled),
+		OnDisk:  atomic.LoadInt64(&s.stats.OnDisk),
+	}
+}
+
+// band 返回优先级所在区间的下界，未设置区间时每个优先级单独作为一个区间
+func (s *Schedule) band(priority int64) int64 {
+	if len(s.bands) == 0 {
+		return priority
+	}
+	b := s.bands[0]
+	for _, bound := range s.bands {
+		if priority >= bound {
+			b = bound
+		}
+	}
+	return b
+}
+
+func (s *Schedule) addDepth(req *collect.Request, n int) {
+	s.depthLock.Lock()
+	defer s.depthLock.Unlock()
+	b := s.band(req.Priority)
+	s.depth[b] += n
+	if s.depth[b] == 0 {
+		delete(s.depth, b)
+	}
+}
+
+// QueueDepth 返回各优先级区间中等待处理的任务数，key 为区间下界
+func (s *Schedule) QueueDepth() map[int64]int {
+	s.depthLock.Lock()
+	defer s.depthLock.Unlock()
+	depth := make(map[int64]int, len(s.depth))
+	for b, n := range s.depth {
+		depth[b] = n
+	}
+	return depth
+}
+
 // Pull 取出一个任务
 func (s *Schedule) Pull() *collect.Request {
-	r := <-s.workerCh
-	return r
+	select {
+	case r := <-s.workerCh:
+		return r
+	case <-s.done:
+		return nil
+	}
 }
 
-// Push 推入任务
+// Push 推入任务。阻塞策略下队列已满时会等待，一次 Push 最多阻塞 blockTimeout，超时后无法推入的请求会被丢弃
 func (s *Schedule) Push(reqs ...*collect.Request) {
+	var timeout <-chan time.Time
+	if s.queueSize > 0 && s.fullPolicy == FullBlock && s.blockTimeout > 0 {
+		timer := time.NewTimer(s.blockTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	expired := false
 	for _, req := range reqs {
-		s.requestCh <- req
+		if expired {
+			select {
+			case s.requestCh <- req:
+			case <-s.done:
+				return
+			default:
+				s.drop(req)
+			}
+			continue
+		}
+		select {
+		case s.requestCh <- req:
+		case <-timeout:
+			expired = true
+			s.drop(req)
+		case <-s.done:
+			return
+		}
 	}
 }
@@ -0,0 +1,294 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFetcher 返回固定内容的抓取器，记录抓取过的地址
+type fakeFetcher struct {
+	mu   sync.Mutex
+	urls []string
+	get  func(req *collect.Request) (*collect.Response, error) // 为空时返回 200 和地址本身
+}
+
+func (f *fakeFetcher) Get(req *collect.Request) (*collect.Response, error) {
+	f.mu.Lock()
+	f.urls = append(f.urls, req.Url)
+	f.mu.Unlock()
+	if f.get != nil {
+		return f.get(req)
+	}
+	return &collect.Response{StatusCode: 200, Body: []byte(req.Url), URL: req.Url}, nil
+}
+
+func (f *fakeFetcher) fetched() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.urls...)
+}
+
+// listTask 返回一个列表页和 n 个详情页的任务
+func listTask(name string, n int) *collect.Task {
+	return &collect.Task{
+		Property: collect.Property{Name: name, MaxDepth: 5},
+		Rule: collect.RuleTree{
+			Root: func() ([]*collect.Request, error) {
+				return []*collect.Request{{Url: "http://" + name + "/list", RuleName: "list"}}, nil
+			},
+			Trunk: map[string]*collect.Rule{
+				"list": {ParseFunc: func(ctx *collect.Context) (collect.ParseResult, error) {
+					var result collect.ParseResult
+					for i := 0; i < n; i++ {
+						result.Requesrts = append(result.Requesrts, &collect.Request{
+							Task:     ctx.Req.Task,
+							Url:      fmt.Sprintf("http://%s/item/%d", name, i),
+							Depth:    ctx.Req.Depth + 1,
+							RuleName: "item",
+						})
+					}
+					return result, nil
+				}},
+				"item": {ParseFunc: func(ctx *collect.Context) (collect.ParseResult, error) {
+					return collect.ParseResult{}, nil
+				}},
+			},
+		},
+	}
+}
+
+// newTestEngine 创建运行 tasks 的引擎，所有任务完成后 Run 返回
+func newTestEngine(f collect.Fetcher, s engine.Scheduler, tasks []*collect.Task, opts ...engine.Option) *engine.Crawler {
+	registry := engine.NewTaskRegistry()
+	var seeds []*collect.Task
+	for _, task := range tasks {
+		registry.Add(task)
+		seeds = append(seeds, &collect.Task{Property: collect.Property{Name: task.Name}, Storage: task.Storage})
+	}
+	opts = append([]engine.Option{
+		engine.WithFetcher(f),
+		engine.WithScheduler(s),
+		engine.WithRegistry(registry),
+		engine.WithSeeds(seeds),
+		engine.WithWorkCount(2),
+		engine.WithStopWhenDone(true),
+	}, opts...)
+	return engine.NewEngine(opts...)
+}
+
+// runEngine 运行引擎，超时未返回时测试失败
+func runEngine(t *testing.T, e *engine.Crawler, timeout time.Duration) {
+	done := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		cancel()
+		<-done
+		t.Fatal("crawler did not finish in time")
+	}
+}
+
+func TestScheduleDropLowest(t *testing.T) {
+	s := engine.NewSchedule(engine.WithQueueSize(2, engine.FullDropLowest))
+	var dropped []string
+	s.OnDrop(func(req *collect.Request) {
+		dropped = append(dropped, req.Url)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Schedule(ctx)
+
+	for i := 1; i <= 4; i++ {
+		s.Push(&collect.Request{Url: fmt.Sprint("p", i), Priority: int64(i)})
+	}
+	assert.Equal(t, "p4", s.Pull().Url)
+	assert.Equal(t, "p3", s.Pull().Url)
+	assert.Equal(t, []string{"p1", "p2"}, dropped)
+	assert.EqualValues(t, 2, s.Stats().Dropped)
+}
+
+func TestScheduleBlockTimeout(t *testing.T) {
+	s := engine.NewSchedule(
+		engine.WithQueueSize(1, engine.FullBlock),
+		engine.WithBlockTimeout(50*time.Millisecond),
+	)
+	var dropped []string
+	s.OnDrop(func(req *collect.Request) {
+		dropped = append(dropped, req.Url)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Schedule(ctx)
+
+	s.Push(&collect.Request{Url: "first"})
+	start := time.Now()
+	s.Push(&collect.Request{Url: "second"})
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, []string{"second"}, dropped)
+	assert.Equal(t, "first", s.Pull().Url)
+}
+
+func TestScheduleSpill(t *testing.T) {
+	s := engine.NewSchedule(
+		engine.WithQueueSize(2, engine.FullSpill),
+		engine.WithSpillDir(t.TempDir()),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Schedule(ctx)
+
+	// 同一个任务的两次运行
+	runs := []*collect.Task{
+		{Property: collect.Property{Name: "spill"}, RunID: "spill-1"},
+		{Property: collect.Property{Name: "spill"}, RunID: "spill-2"},
+	}
+	var pushed []*collect.Request
+	for i := 0; i < 6; i++ {
+		req := &collect.Request{Task: runs[i%2], Url: fmt.Sprint("r", i), Form: map[string][]string{"i": {fmt.Sprint(i)}}}
+		pushed = append(pushed, req)
+		s.Push(req)
+	}
+
+	pulled := make(map[string]*collect.Request)
+	for range pushed {
+		req := s.Pull()
+		require.NotNil(t, req)
+		pulled[req.Url] = req
+	}
+	// 读回的请求内容完整，并且仍属于原来的那次运行
+	require.Len(t, pulled, len(pushed))
+	for i := range pushed {
+		req := pulled[fmt.Sprint("r", i)]
+		require.NotNil(t, req)
+		assert.Equal(t, fmt.Sprint(i), req.Form.Get("i"))
+		assert.Same(t, runs[i%2], req.Task)
+	}
+	stats := s.Stats()
+	assert.EqualValues(t, 4, stats.Spilled)
+	assert.EqualValues(t, 0, stats.OnDisk)
+	assert.EqualValues(t, 0, stats.Dropped)
+}
+
+func TestFullQueueBlocksWorkers(t *testing.T) {
+	f := &fakeFetcher{}
+	s := engine.NewSchedule(
+		engine.WithQueueSize(1, engine.FullBlock),
+		engine.WithBlockTimeout(100*time.Millisecond),
+	)
+	e := newTestEngine(f, s, []*collect.Task{listTask("block", 20)}, engine.WithWorkCount(1))
+	start := time.Now()
+	runEngine(t, e, 5*time.Second)
+
+	// 唯一的 worker 推入时阻塞，没有 worker 取出请求，超时后剩余的请求被丢弃
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	summary, ok := e.Summary("block")
+	require.True(t, ok)
+	assert.True(t, summary.Done())
+	assert.EqualValues(t, 2, summary.Fetched)
+	assert.EqualValues(t, 19, summary.Skipped)
+	assert.EqualValues(t, 19, s.Stats().Dropped)
+	assert.Len(t, f.fetched(), 2)
+}
+
+func TestFullQueueSpillWorkers(t *testing.T) {
+	f := &fakeFetcher{}
+	s := engine.NewSchedule(
+		engine.WithQueueSize(1, engine.FullSpill),
+		engine.WithSpillDir(t.TempDir()),
+	)
+	e := newTestEngine(f, s, []*collect.Task{listTask("spill", 20)}, engine.WithWorkCount(1))
+	runEngine(t, e, 5*time.Second)
+
+	// 溢写不会阻塞 worker，所有请求都被处理
+	summary, _ := e.Summary("spill")
+	assert.EqualValues(t, 21, summary.Fetched)
+	assert.EqualValues(t, 0, s.Stats().Dropped)
+	assert.Len(t, f.fetched(), 21)
+}
+
+func TestPageStateSavedAfterParse(t *testing.T) {
+	cache := collect.NewMemoryPageCache()
+	page := &collect.Request{Url: "http://incremental/page", RuleName: "page"}
+	newTask := func(parseErr error) *collect.Task {
+		return &collect.Task{
+			Property: collect.Property{
+				Name:          "incremental",
+				Incremental:   true,
+				SkipUnchanged: true,
+				Retry:         collect.RetryPolicy{MaxAttempts: 1},
+			},
+			Rule: collect.RuleTree{
+				Root: func() ([]*collect.Request, error) {
+					return []*collect.Request{{Url: page.Url, RuleName: page.RuleName}}, nil
+				},
+				Trunk: map[string]*collect.Rule{
+					"page": {ParseFunc: func(ctx *collect.Context) (collect.ParseResult, error) {
+						return collect.ParseResult{}, parseErr
+					}},
+				},
+			},
+		}
+	}
+	page.Task = newTask(nil)
+	key := page.Task.Name + ":" + page.Unique()
+
+	// 解析失败的页面不记录状态，下次仍会重新解析
+	e := newTestEngine(&fakeFetcher{}, engine.NewSchedule(), []*collect.Task{newTask(errors.New("bad page"))},
+		engine.WithPageCache(cache))
+	runEngine(t, e, 5*time.Second)
+	summary, _ := e.Summary("incremental")
+	assert.EqualValues(t, 1, summary.Failed)
+	_, ok := cache.Get(key)
+	assert.False(t, ok)
+
+	e = newTestEngine(&fakeFetcher{}, engine.NewSchedule(), []*collect.Task{newTask(nil)},
+		engine.WithPageCache(cache))
+	runEngine(t, e, 5*time.Second)
+	summary, _ = e.Summary("incremental")
+	assert.EqualValues(t, 1, summary.Fetched)
+	_, ok = cache.Get(key)
+	assert.True(t, ok)
+
+	// 内容没有变化，不再解析
+	e = newTestEngine(&fakeFetcher{}, engine.NewSchedule(), []*collect.Task{newTask(nil)},
+		engine.WithPageCache(cache))
+	runEngine(t, e, 5*time.Second)
+	summary, _ = e.Summary("incremental")
+	assert.EqualValues(t, 1, summary.Unchanged)
+}
+
+func TestAfterParseRetry(t *testing.T) {
+	f := &fakeFetcher{}
+	task := listTask("after-parse", 0)
+	task.Retry = collect.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+	retry := collect.MiddlewareFuncs{
+		Parsed: func(req *collect.Request, result *collect.ParseResult) error {
+			if req.Retry == 0 {
+				return collect.ErrRetry
+			}
+			return nil
+		},
+	}
+	e := newTestEngine(f, engine.NewSchedule(), []*collect.Task{task}, engine.WithMiddleware(retry))
+	runEngine(t, e, 5*time.Second)
+
+	summary, _ := e.Summary("after-parse")
+	assert.EqualValues(t, 1, summary.Fetched)
+	assert.EqualValues(t, 0, summary.Failed)
+	assert.Len(t, f.fetched(), 2)
+}
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/session"
+	"go.uber.org/zap"
+)
+
+// 任务会话
+// 配置了 Session 的任务由引擎创建会话池，同一个任务的多次运行共用会话池，
+// 每次运行结束和引擎停止时将会话保存到磁盘。
+
+// sessionPool 返回任务的会话池，不存在时创建，创建失败时任务不使用会话
+func (c *Crawler) sessionPool(name string, opts session.Options) *session.Pool {
+	c.sessionLock.Lock()
+	defer c.sessionLock.Unlock()
+	if pool, ok := c.sessions[name]; ok {
+		return pool
+	}
+	pool, err := session.NewPool(name, opts)
+	if err != nil {
+		c.Logger.Error("load session failed", zap.String("task", name), zap.Error(err))
+		return nil
+	}
+	c.sessions[name] = pool
+	return pool
+}
+
+// saveSession 保存任务的会话
+func (c *Crawler) saveSession(task *collect.Task) {
+	if task.Sessions == nil {
+		return
+	}
+	if err := task.Sessions.Save(); err != nil {
+		c.Logger.Error("save session failed", zap.String("task", task.Name), zap.Error(err))
+	}
+}
+
+// saveSessions 保存所有任务的会话
+func (c *Crawler) saveSessions() {
+	c.sessionLock.Lock()
+	defer c.sessionLock.Unlock()
+	for name, pool := range c.sessions {
+		if err := pool.Save(); err != nil {
+			c.Logger.Error("save session failed", zap.String("task", name), zap.Error(err))
+		}
+	}
+}
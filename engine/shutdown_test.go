@@ -0,0 +1,102 @@
+package engine_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/engine"
+	"github.com/nico612/crawler-go/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// memStorage 缓存数据，Flush 后才算写入
+type memStorage struct {
+	mu      sync.Mutex
+	buf     []*storage.DataCell
+	flushed []*storage.DataCell
+}
+
+func (s *memStorage) Save(cells ...*storage.DataCell) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = append(s.buf, cells...)
+	return nil
+}
+
+func (s *memStorage) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushed = append(s.flushed, s.buf...)
+	s.buf = nil
+	return nil
+}
+
+func (s *memStorage) items() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.flushed)
+}
+
+// pageTask 只有一个页面的任务，页面解析出一条数据
+func pageTask(name string) *collect.Task {
+	return &collect.Task{
+		Property: collect.Property{Name: name},
+		Rule: collect.RuleTree{
+			Root: func() ([]*collect.Request, error) {
+				return []*collect.Request{{Url: "http://" + name + "/page", RuleName: "page"}}, nil
+			},
+			Trunk: map[string]*collect.Rule{
+				"page": {ParseFunc: func(ctx *collect.Context) (collect.ParseResult, error) {
+					return collect.ParseResult{Items: []interface{}{ctx.Output(ctx.Req.Url)}}, nil
+				}},
+			},
+		},
+		Storage: &memStorage{},
+	}
+}
+
+// blockingFetcher 抓取时通知 started 并阻塞到 release 关闭
+func blockingFetcher() (f *fakeFetcher, started <-chan struct{}, release chan struct{}) {
+	start := make(chan struct{}, 1)
+	release = make(chan struct{})
+	f = &fakeFetcher{get: func(req *collect.Request) (*collect.Response, error) {
+		start <- struct{}{}
+		<-release
+		return &collect.Response{StatusCode: 200, Body: []byte(req.Url), URL: req.Url}, nil
+	}}
+	return f, start, release
+}
+
+func TestShutdownFlushesInFlight(t *testing.T) {
+	f, started, release := blockingFetcher()
+	task := pageTask("shutdown")
+	e := newTestEngine(f, engine.NewSchedule(), []*collect.Task{task})
+	stop, _ := startEngine(e)
+
+	<-started
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	stop()
+	// 停止时正在抓取的请求处理完成，数据储存并刷新后 Run 才返回
+	assert.Equal(t, 1, task.Storage.(*memStorage).items())
+	summary, _ := e.Summary("shutdown")
+	assert.EqualValues(t, 1, summary.Fetched)
+	assert.EqualValues(t, 1, summary.Saved)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	f, started, release := blockingFetcher()
+	defer close(release)
+	e := newTestEngine(f, engine.NewSchedule(), []*collect.Task{pageTask("stuck")},
+		engine.WithShutdownTimeout(50*time.Millisecond))
+	stop, done := startEngine(e)
+
+	<-started
+	go stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("crawler did not stop after shutdown timeout")
+	}
+}
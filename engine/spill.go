@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/nico612/crawler-go/collect"
+	"os"
+)
+
+// spillFile 队列已满时溢写请求的临时文件，先进先出。
+// 文件中的请求被全部读出后会清空文件，关闭时删除文件。
+type spillFile struct {
+	w      *os.File
+	r      *os.File
+	reader *bufio.Reader
+	count  int // 文件中尚未读出的请求数
+}
+
+func newSpillFile(dir string) (*spillFile, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w, err := os.CreateTemp(dir, "spill-*.log")
+	if err != nil {
+		return nil, err
+	}
+	r, err := os.Open(w.Name())
+	if err != nil {
+		w.Close()
+		os.Remove(w.Name())
+		return nil, err
+	}
+	return &spillFile{
+		w:      w,
+		r:      r,
+		reader: bufio.NewReader(r),
+	}, nil
+}
+
+func (f *spillFile) write(rec collect.RequestRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := f.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	f.count++
+	return nil
+}
+
+func (f *spillFile) read() (collect.RequestRecord, error) {
+	var rec collect.RequestRecord
+	// 读取失败时这条请求同样算作已读出，保证 count 与溢写的请求数一致
+	line, err := f.reader.ReadBytes('\n')
+	f.count--
+	if f.count == 0 {
+		// 全部读出后清空文件，避免文件无限增长
+		if rerr := f.reset(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	if err != nil {
+		return rec, err
+	}
+	return rec, json.Unmarshal(line, &rec)
+}
+
+func (f *spillFile) reset() error {
+	if err := f.w.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.w.Seek(0, 0); err != nil {
+		return err
+	}
+	if _, err := f.r.Seek(0, 0); err != nil {
+		return err
+	}
+	f.reader.Reset(f.r)
+	return nil
+}
+
+func (f *spillFile) close() error {
+	f.r.Close()
+	f.w.Close()
+	return os.Remove(f.w.Name())
+}
@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/nico612/crawler-go/collect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnspillReadError(t *testing.T) {
+	s := NewSchedule(WithQueueSize(1, FullSpill), WithSpillDir(t.TempDir()))
+	var dropped []*collect.Request
+	s.OnDrop(func(req *collect.Request) {
+		dropped = append(dropped, req)
+	})
+	task := &collect.Task{Property: collect.Property{Name: "spill"}}
+	for i := 0; i < 3; i++ {
+		s.push(&collect.Request{Task: task, Url: fmt.Sprint("r", i)})
+	}
+	require.Len(t, s.spilled, 2)
+	// 溢写文件损坏，读回失败的请求被丢弃，调度器继续运行
+	require.NoError(t, s.spill.w.Truncate(0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Schedule(ctx)
+	assert.Equal(t, "r0", s.Pull().Url)
+	cancel()
+	<-s.done
+	require.Len(t, dropped, 2)
+	for _, req := range dropped {
+		assert.Same(t, task, req.Task)
+	}
+	assert.Empty(t, s.spilled)
+	assert.Zero(t, s.spill.count)
+	assert.EqualValues(t, 0, s.Stats().OnDisk)
+}
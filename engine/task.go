@@ -0,0 +1,295 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nico612/crawler-go/collect"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+// 任务生命周期
+// 引擎运行期间可以启动注册表中的任务，暂停、恢复或取消正在运行的任务。
+// 每次启动都会复制注册表中的任务，请求通过 Task 指针区分属于哪一次运行。
+// 暂停的任务的请求被工作协程取出后暂存在引擎中，恢复时重新推入调度器；
+// 取消的任务和之前运行遗留的请求在被取出时丢弃。
+
+// TaskState 任务状态
+type TaskState string
+
+const (
+	TaskRunning   TaskState = "running"
+	TaskPaused    TaskState = "paused"
+	TaskCancelled TaskState = "cancelled"
+	TaskStopped   TaskState = "stopped" // 超出预算停止
+	TaskDone      TaskState = "done"
+)
+
+var (
+	ErrTaskNotFound   = errors.New("task not found")
+	ErrTaskRunning    = errors.New("task is running")
+	ErrTaskNotRunning = errors.New("task is not running")
+	ErrTaskNotPaused  = errors.New("task is not paused")
+)
+
+// TaskStatus 任务当前的状态和本次运行的统计
+type TaskStatus struct {
+	Name       string
+	State      TaskState
+	Parked     int    // 暂停期间暂存的请求数
+	StopReason string // 超出预算的原因
+	Summary    TaskSummary
+}
+
+// taskRun 任务的一次运行
+type taskRun struct {
+	task   *collect.Task
+	state  TaskState
+	parked []*collect.Request // 暂停期间取出的请求
+	queued bool               // 运行期间周期任务再次被触发，结束后需要重新开始
+
+	usage      budgetUsage
+	stopReason string
+}
+
+// newRun 复制注册表中的任务，Seeds 中有同名任务时使用其配置，否则使用引擎的配置
+func (c *Crawler) newRun(name string) *taskRun {
+	registered := c.Registry.Get(name)
+	if registered == nil {
+		return nil
+	}
+	task := *registered
+	task.Fetcher = c.Fetcher
+	for _, seed := range c.Seeds {
+		if seed.Name != name {
+			continue
+		}
+		if seed.Fetcher != nil {
+			task.Fetcher = seed.Fetcher
+		}
+		task.Storage = seed.Storage
+		task.Limit = seed.Limit
+		break
+	}
+	task.Logger = c.Logger
+	task.Cache = c.PageCache
+	task.Middlewares = append(append([]collect.Middleware(nil), c.Middlewares...), registered.Middlewares...)
+	if task.Sessions == nil && (task.Session.Enabled() || task.Login.Enabled()) {
+		task.Sessions = c.sessionPool(name, task.Session)
+	}
+	if task.Cron != "" {
+		task.RunID = fmt.Sprintf("%s-%d", name, time.Now().UnixNano())
+	}
+	return &taskRun{task: &task, state: TaskRunning}
+}
+
+// rootRequests 登录后返回任务的初始请求
+func (c *Crawler) rootRequests(task *collect.Task) ([]*collect.Request, error) {
+	if err := c.login(task); err != nil {
+		return nil, err
+	}
+	reqs, err := task.Rule.Root()
+	if err != nil {
+		return nil, err
+	}
+	for _, req := range reqs {
+		req.Task = task
+	}
+	return reqs, nil
+}
+
+// StartTask 启动注册表中的任务，需要在引擎运行时调用。
+// 任务正在运行或已暂停时返回 ErrTaskRunning，已完成或已取消的任务会重新开始一次运行。
+func (c *Crawler) StartTask(name string) error {
+	c.taskLock.Lock()
+	if run, ok := c.runs[name]; ok && (run.state == TaskRunning || run.state == TaskPaused) {
+		c.taskLock.Unlock()
+		return ErrTaskRunning
+	}
+	run := c.newRun(name)
+	if run == nil {
+		c.taskLock.Unlock()
+		return ErrTaskNotFound
+	}
+	c.runs[name] = run
+	c.taskLock.Unlock()
+
+	reqs, err := c.rootRequests(run.task)
+	c.tracker.register(run.task)
+	c.startBudget(run)
+	c.tracker.add(reqs...)
+	c.tracker.start(run.task)
+	if err != nil {
+		return fmt.Errorf("get root: %w", err)
+	}
+	c.Logger.Info("task started", zap.String("task", name), zap.Int("requests", len(reqs)))
+	c.scheduler.Push(reqs...)
+	return nil
+}
+
+// PauseTask 暂停任务，任务的请求保留但不再被处理，正在处理的请求不受影响
+func (c *Crawler) PauseTask(name string) error {
+	c.taskLock.Lock()
+	defer c.taskLock.Unlock()
+	run, ok := c.runs[name]
+	if !ok {
+		return ErrTaskNotFound
+	}
+	if run.state != TaskRunning {
+		return ErrTaskNotRunning
+	}
+	run.state = TaskPaused
+	c.Logger.Info("task paused", zap.String("task", name))
+	return nil
+}
+
+// ResumeTask 恢复暂停的任务，暂存的请求重新推入调度器
+func (c *Crawler) ResumeTask(name string) error {
+	c.taskLock.Lock()
+	run, ok := c.runs[name]
+	if !ok {
+		c.taskLock.Unlock()
+		return ErrTaskNotFound
+	}
+	if run.state != TaskPaused {
+		c.taskLock.Unlock()
+		return ErrTaskNotPaused
+	}
+	run.state = TaskRunning
+	parked := run.parked
+	run.parked = nil
+	c.taskLock.Unlock()
+
+	c.Logger.Info("task resumed", zap.String("task", name), zap.Int("parked", len(parked)))
+	if len(parked) > 0 {
+		// 暂存的请求已经计入未处理完的请求数，直接推入调度器
+		c.scheduler.Push(parked...)
+	}
+	return nil
+}
+
+// CancelTask 取消任务，丢弃暂存的请求，调度器中剩余的请求在被取出时丢弃
+func (c *Crawler) CancelTask(name string) error {
+	c.taskLock.Lock()
+	run, ok := c.runs[name]
+	if !ok {
+		c.taskLock.Unlock()
+		return ErrTaskNotFound
+	}
+	if run.state != TaskRunning && run.state != TaskPaused {
+		c.taskLock.Unlock()
+		return ErrTaskNotRunning
+	}
+	run.state = TaskCancelled
+	run.queued = false
+	if run.usage.timer != nil {
+		run.usage.timer.Stop()
+	}
+	parked := run.parked
+	run.parked = nil
+	c.taskLock.Unlock()
+
+	c.Logger.Info("task cancelled", zap.String("task", name), zap.Int("parked", len(parked)))
+	c.dropParked(parked)
+	return nil
+}
+
+// TaskStatus 返回任务当前的状态
+func (c *Crawler) TaskStatus(name string) (TaskStatus, bool) {
+	c.taskLock.RLock()
+	run, ok := c.runs[name]
+	if !ok {
+		c.taskLock.RUnlock()
+		return TaskStatus{}, false
+	}
+	status := TaskStatus{Name: name, State: run.state, Parked: len(run.parked), StopReason: run.stopReason}
+	task := run.task
+	c.taskLock.RUnlock()
+
+	status.Summary, _ = c.tracker.summary(task)
+	return status, true
+}
+
+// TaskStatuses 按任务名顺序返回所有启动过的任务的状态
+func (c *Crawler) TaskStatuses() []TaskStatus {
+	c.taskLock.RLock()
+	names := make([]string, 0, len(c.runs))
+	for name := range c.runs {
+		names = append(names, name)
+	}
+	c.taskLock.RUnlock()
+	sort.Strings(names)
+
+	list := make([]TaskStatus, 0, len(names))
+	for _, name := range names {
+		if status, ok := c.TaskStatus(name); ok {
+			list = append(list, status)
+		}
+	}
+	return list
+}
+
+// admit 工作协程取出请求后调用，返回 false 表示请求已被暂存或丢弃
+func (c *Crawler) admit(req *collect.Request) bool {
+	c.taskLock.Lock()
+	run := c.runs[req.Task.Name]
+	switch {
+	case run == nil || run.task != req.Task || run.state == TaskCancelled || run.state == TaskStopped:
+		c.taskLock.Unlock()
+		c.Logger.Debug("drop request of stopped task",
+			zap.String("task", req.Task.Name),
+			zap.String("url", req.Url),
+		)
+		c.finish(req, resultSkipped)
+		return false
+	case run.state == TaskPaused:
+		run.parked = append(run.parked, req)
+		c.taskLock.Unlock()
+		return false
+	case run.state == TaskDone:
+		// 已完成的任务重新有了请求，例如重新加入调度的死信
+		run.state = TaskRunning
+	}
+	c.taskLock.Unlock()
+	return true
+}
+
+// taskDone 一次运行的请求全部处理完时调用
+func (c *Crawler) taskDone(task *collect.Task) {
+	c.visitLock.Lock()
+	delete(c.runVisited, task)
+	c.visitLock.Unlock()
+
+	c.taskLock.Lock()
+	run := c.currentRun(task)
+	if run == nil || (run.state != TaskRunning && run.state != TaskStopped) {
+		c.taskLock.Unlock()
+		return
+	}
+	if run.state == TaskRunning {
+		run.state = TaskDone
+	}
+	if run.usage.timer != nil {
+		run.usage.timer.Stop()
+	}
+	queued := run.queued
+	run.queued = false
+	c.taskLock.Unlock()
+
+	c.saveSession(task)
+	if queued {
+		go c.trigger(task.Name)
+	}
+}
+
+// task 根据名称返回任务当前的运行，任务不存在、已取消或已停止时返回 nil
+func (c *Crawler) task(name string) *collect.Task {
+	c.taskLock.RLock()
+	defer c.taskLock.RUnlock()
+	run, ok := c.runs[name]
+	if !ok || run.state == TaskCancelled || run.state == TaskStopped {
+		return nil
+	}
+	return run.task
+}
@@ -0,0 +1,102 @@
+package engine_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startEngine 在后台运行引擎，返回的函数停止引擎并等待 Run 返回
+func startEngine(e *engine.Crawler) (stop func(), done <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(ch)
+	}()
+	return func() {
+		cancel()
+		<-ch
+	}, ch
+}
+
+// pauseOnList 抓取列表页时暂停任务的引擎，列表页解析得到的请求全部被暂存
+func pauseOnList(t *testing.T, name string, s engine.Scheduler) (*engine.Crawler, *fakeFetcher) {
+	var e *engine.Crawler
+	f := &fakeFetcher{}
+	f.get = func(req *collect.Request) (*collect.Response, error) {
+		if strings.HasSuffix(req.Url, "/list") {
+			// 在 worker 协程中执行，不能使用 require
+			assert.NoError(t, e.PauseTask(name))
+		}
+		return &collect.Response{StatusCode: 200, Body: []byte(req.Url), URL: req.Url}, nil
+	}
+	e = newTestEngine(f, s, []*collect.Task{listTask(name, 10)})
+	return e, f
+}
+
+func waitParked(t *testing.T, e *engine.Crawler, name string, n int) {
+	assert.Eventually(t, func() bool {
+		status, _ := e.TaskStatus(name)
+		return status.State == engine.TaskPaused && status.Parked == n
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPauseResumeTask(t *testing.T) {
+	e, f := pauseOnList(t, "pause", engine.NewSchedule())
+	stop, done := startEngine(e)
+	defer stop()
+
+	waitParked(t, e, "pause", 10)
+	assert.Len(t, f.fetched(), 1)
+	assert.ErrorIs(t, e.ResumeTask("missing"), engine.ErrTaskNotFound)
+
+	require.NoError(t, e.ResumeTask("pause"))
+	assert.ErrorIs(t, e.ResumeTask("pause"), engine.ErrTaskNotPaused)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task did not finish after resume")
+	}
+	summary, _ := e.Summary("pause")
+	assert.EqualValues(t, 11, summary.Fetched)
+	assert.Len(t, f.fetched(), 11)
+}
+
+func TestCancelPausedTask(t *testing.T) {
+	e, f := pauseOnList(t, "cancel", engine.NewSchedule())
+	stop, done := startEngine(e)
+	defer stop()
+
+	waitParked(t, e, "cancel", 10)
+	require.NoError(t, e.CancelTask("cancel"))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task did not finish after cancel")
+	}
+	status, _ := e.TaskStatus("cancel")
+	assert.Equal(t, engine.TaskCancelled, status.State)
+	assert.EqualValues(t, 1, status.Summary.Fetched)
+	assert.EqualValues(t, 10, status.Summary.Skipped)
+	assert.Len(t, f.fetched(), 1)
+}
+
+func TestParkedRequestsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := engine.NewDiskSchedule(dir, engine.NewSchedule())
+	require.NoError(t, err)
+	e, _ := pauseOnList(t, "parked", s)
+	stop, _ := startEngine(e)
+
+	waitParked(t, e, "parked", 10)
+	stop()
+	// 暂存的请求还没有处理，重启后恢复
+	assert.Len(t, restoreURLs(t, dir, listTask("parked", 10)), 10)
+}
@@ -0,0 +1,238 @@
+package engine
+
+import (
+	"github.com/nico612/crawler-go/collect"
+	"sync"
+	"time"
+)
+
+// 任务完成检测
+// 引擎记录每个任务还未处理完的请求数，请求推入调度器时加一，处理结束（解析结果已处理、被跳过或永久失败）时减一。
+// 等待重试的请求仍然算作未处理完。当某个任务的请求全部处理完时，任务完成；所有任务都完成时，本次爬取完成。
+// 同一个任务可以多次运行，每次运行使用单独的 *collect.Task，分别统计。
+
+// TaskSummary 任务的执行统计
+type TaskSummary struct {
+	Name       string
+	Start      time.Time
+	End        time.Time // 任务未完成时为零值
+	Requests   int64     // 推入调度器的请求数
+	Fetched    int64     // 成功抓取并解析的请求数
+	Failed     int64     // 永久失败的请求数
+	Skipped    int64     // 因已访问、超过深度等原因跳过的请求数
+	Unchanged  int64     // 页面未变化而没有解析的请求数
+	Items      int64     // 解析得到的数据条数
+	Dropped    int64     // 被数据处理管道丢弃或处理失败的数据条数
+	Saved      int64     // 成功储存的数据条数
+	SaveFailed int64     // 重试后仍然储存失败的数据条数
+	StopReason string    // 超出预算停止或跳过请求时的原因
+}
+
+// Done 任务是否已经完成
+func (s TaskSummary) Done() bool {
+	return !s.End.IsZero()
+}
+
+// requestResult 请求处理结束的方式
+type requestResult int
+
+const (
+	resultFetched requestResult = iota
+	resultFailed
+	resultSkipped
+	resultUnchanged
+)
+
+// runHistory 每个任务最多保留的已完成运行数
+const runHistory = 100
+
+type taskTracker struct {
+	summary TaskSummary
+	pending int64
+}
+
+// tracker 记录各个任务未处理完的请求数
+type tracker struct {
+	mu     sync.Mutex
+	tasks  map[*collect.Task]*taskTracker
+	order  []*collect.Task
+	onTask func(*collect.Task, TaskSummary) // 单次任务运行完成时回调
+	onDone func([]TaskSummary)              // 所有任务完成时回调
+}
+
+func newTracker(onTask func(*collect.Task, TaskSummary), onDone func([]TaskSummary)) *tracker {
+	return &tracker{
+		tasks:  make(map[*collect.Task]*taskTracker),
+		onTask: onTask,
+		onDone: onDone,
+	}
+}
+
+func (t *tracker) get(task *collect.Task) *taskTracker {
+	tt, ok := t.tasks[task]
+	if !ok {
+		tt = &taskTracker{summary: TaskSummary{Name: task.Name, Start: time.Now()}}
+		t.tasks[task] = tt
+		t.order = append(t.order, task)
+	}
+	return tt
+}
+
+// register 登记任务，需要在推入请求前登记所有任务，避免部分任务完成时误判为全部完成
+func (t *tracker) register(tasks ...*collect.Task) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, task := range tasks {
+		t.get(task)
+		t.prune(task.Name)
+	}
+}
+
+// prune 删除任务多余的已完成运行
+func (t *tracker) prune(name string) {
+	var done int
+	for _, task := range t.order {
+		if task.Name == name && t.tasks[task].summary.Done() {
+			done++
+		}
+	}
+	if done <= runHistory {
+		return
+	}
+	order := t.order[:0]
+	for _, task := range t.order {
+		if done > runHistory && task.Name == name && t.tasks[task].summary.Done() {
+			delete(t.tasks, task)
+			done--
+			continue
+		}
+		order = append(order, task)
+	}
+	t.order = order
+}
+
+// start 任务的初始请求推入后调用，任务没有任何请求时立即完成
+func (t *tracker) start(task *collect.Task) {
+	t.complete(task)
+}
+
+// add 推入请求前调用
+func (t *tracker) add(reqs ...*collect.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, req := range reqs {
+		tt := t.get(req.Task)
+		tt.pending++
+		tt.summary.Requests++
+		// 已完成的任务重新有了请求
+		tt.summary.End = time.Time{}
+	}
+}
+
+// update 更新数据条数等统计
+func (t *tracker) update(task *collect.Task, f func(s *TaskSummary)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f(&t.get(task).summary)
+}
+
+// finish 请求处理结束时调用
+func (t *tracker) finish(req *collect.Request, result requestResult) {
+	t.mu.Lock()
+	tt := t.get(req.Task)
+	tt.pending--
+	switch result {
+	case resultFetched:
+		tt.summary.Fetched++
+	case resultFailed:
+		tt.summary.Failed++
+	case resultSkipped:
+		tt.summary.Skipped++
+	case resultUnchanged:
+		tt.summary.Unchanged++
+	}
+	pending := tt.pending
+	t.mu.Unlock()
+
+	if pending == 0 {
+		t.complete(req.Task)
+	}
+}
+
+func (t *tracker) complete(task *collect.Task) {
+	t.mu.Lock()
+	tt := t.get(task)
+	if tt.pending != 0 || tt.summary.Done() {
+		t.mu.Unlock()
+		return
+	}
+	tt.summary.End = time.Now()
+	summary := tt.summary
+
+	allDone := true
+	for _, other := range t.tasks {
+		if !other.summary.Done() {
+			allDone = false
+			break
+		}
+	}
+	var summaries []TaskSummary
+	if allDone {
+		summaries = t.summariesLocked()
+	}
+	t.mu.Unlock()
+
+	if t.onTask != nil {
+		t.onTask(task, summary)
+	}
+	if allDone && t.onDone != nil {
+		t.onDone(summaries)
+	}
+}
+
+// pending 返回所有任务未处理完的请求数
+func (t *tracker) pending() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var n int64
+	for _, tt := range t.tasks {
+		n += tt.pending
+	}
+	return n
+}
+
+func (t *tracker) summary(task *collect.Task) (TaskSummary, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tt, ok := t.tasks[task]
+	if !ok {
+		return TaskSummary{}, false
+	}
+	return tt.summary, true
+}
+
+func (t *tracker) runs(name string) []TaskSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var list []TaskSummary
+	for _, task := range t.order {
+		if task.Name == name {
+			list = append(list, t.tasks[task].summary)
+		}
+	}
+	return list
+}
+
+func (t *tracker) summaries() []TaskSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.summariesLocked()
+}
+
+func (t *tracker) summariesLocked() []TaskSummary {
+	list := make([]TaskSummary, 0, len(t.order))
+	for _, task := range t.order {
+		list = append(list, t.tasks[task].summary)
+	}
+	return list
+}
@@ -0,0 +1,43 @@
+package engine_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopWhenDone(t *testing.T) {
+	var mu sync.Mutex
+	var finished []string
+	var all [][]engine.TaskSummary
+	e := newTestEngine(&fakeFetcher{}, engine.NewSchedule(),
+		[]*collect.Task{listTask("one", 2), listTask("two", 3)},
+		engine.WithOnTaskDone(func(s engine.TaskSummary) {
+			mu.Lock()
+			defer mu.Unlock()
+			finished = append(finished, s.Name)
+		}),
+		engine.WithOnDone(func(summaries []engine.TaskSummary) {
+			mu.Lock()
+			defer mu.Unlock()
+			all = append(all, summaries)
+		}),
+	)
+	runEngine(t, e, 5*time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []string{"one", "two"}, finished)
+	require.Len(t, all, 1)
+	fetched := make(map[string]int64)
+	for _, s := range all[0] {
+		assert.True(t, s.Done())
+		fetched[s.Name] = s.Fetched
+	}
+	assert.Equal(t, map[string]int64{"one": 3, "two": 4}, fetched)
+}
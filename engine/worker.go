@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/nico612/crawler-go/collect"
+	"go.uber.org/zap"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// worker 监督
+// 处理单个请求或解析结果时发生的 panic 只会导致该请求失败，请求连同堆栈被放入死信队列。
+// 其他位置的 panic 导致 worker 退出时，CreateWork 会重新启动 worker，保持 worker 数量不变。
+// worker 数量可以在运行时通过 SetWorkerCount 调整，多余的 worker 在取下一个请求前退出。
+
+// PanicError 处理请求时发生的 panic
+type PanicError struct {
+	Value interface{}
+	Stack string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack)
+}
+
+// WorkerStats worker 的统计
+type WorkerStats struct {
+	Workers  int64 // 正在运行的 worker 数
+	Target   int64 // 目标 worker 数
+	Restarts int64 // worker 因 panic 重新启动的次数
+	Panics   int64 // 处理请求和解析结果时发生 panic 的次数
+}
+
+// workerPool 记录 worker 的数量
+type workerPool struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	target  int  // 目标 worker 数
+	running int  // 正在运行的 worker 数
+	started bool // Run 已经启动 worker
+	stopped bool // 引擎正在停止，不再启动新的 worker
+}
+
+// WorkerStats 返回 worker 的统计
+func (c *Crawler) WorkerStats() WorkerStats {
+	c.workers.mu.Lock()
+	running, target := c.workers.running, c.workers.target
+	c.workers.mu.Unlock()
+	return WorkerStats{
+		Workers:  int64(running),
+		Target:   int64(target),
+		Restarts: atomic.LoadInt64(&c.workerStats.Restarts),
+		Panics:   atomic.LoadInt64(&c.workerStats.Panics),
+	}
+}
+
+// SetWorkerCount 设置 worker 数量，引擎运行时立即启动新的 worker 或让多余的 worker 退出。
+// 开启了自适应调整时，数量被限制在 MinWorkers 和 MaxWorkers 之间，之后仍会被自动调整。
+func (c *Crawler) SetWorkerCount(n int) {
+	if c.MaxWorkers > 0 {
+		if n < c.MinWorkers {
+			n = c.MinWorkers
+		}
+		if n > c.MaxWorkers {
+			n = c.MaxWorkers
+		}
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	p := &c.workers
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.target = n
+	if !p.started || p.stopped {
+		return
+	}
+	for p.running < p.target {
+		p.running++
+		p.wg.Add(1)
+		go c.CreateWork()
+	}
+}
+
+// startWorkers 启动 worker
+func (c *Crawler) startWorkers() {
+	c.workers.mu.Lock()
+	c.workers.started = true
+	target := c.workers.target
+	c.workers.mu.Unlock()
+	if target == 0 {
+		target = c.WorkCount
+	}
+	c.SetWorkerCount(target)
+}
+
+// stopWorkers 不再启动新的 worker，返回所有 worker 退出时关闭的通道
+func (c *Crawler) stopWorkers() <-chan struct{} {
+	c.workers.mu.Lock()
+	c.workers.stopped = true
+	c.workers.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.workers.wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// retire worker 数量超过目标时让当前 worker 退出
+func (c *Crawler) retire() bool {
+	p := &c.workers
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running <= p.target {
+		return false
+	}
+	p.running--
+	return true
+}
+
+// CreateWork 运行一个 worker，worker 因 panic 退出时重新启动，调度器停止或 worker 数量减少后返回
+func (c *Crawler) CreateWork() {
+	defer c.workers.wg.Done()
+	for !c.work() {
+		restarts := atomic.AddInt64(&c.workerStats.Restarts, 1)
+		c.Logger.Warn("worker restarted", zap.Int64("restarts", restarts))
+	}
+}
+
+// work 循环处理请求，调度器停止或 worker 退役后返回 true，发生 panic 时返回 false
+func (c *Crawler) work() (stopped bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			c.Logger.Error("worker panic",
+				zap.Any("err", err),
+				zap.String("stack", string(debug.Stack())))
+		}
+	}()
+
+	for {
+		if c.retire() {
+			c.Logger.Debug("worker retired")
+			return true
+		}
+		// 取出一个任务，调度器停止后返回 nil
+		req := c.scheduler.Pull()
+		if req == nil {
+			c.workers.mu.Lock()
+			c.workers.running--
+			c.workers.mu.Unlock()
+			return true
+		}
+		// 任务已暂停或取消
+		if !c.admit(req) {
+			continue
+		}
+		atomic.AddInt64(&c.busy, 1)
+		c.safeProcess(req)
+		atomic.AddInt64(&c.busy, -1)
+	}
+}
+
+// safeProcess 处理请求，发生 panic 时请求失败并放入死信队列，不再重试
+func (c *Crawler) safeProcess(req *collect.Request) {
+	defer func() {
+		if v := recover(); v != nil {
+			atomic.AddInt64(&c.workerStats.Panics, 1)
+			err := &PanicError{Value: v, Stack: string(debug.Stack())}
+			c.Logger.Error("request panic",
+				zap.String("task", req.Task.Name),
+				zap.String("url", req.Url),
+				zap.Any("err", v),
+				zap.String("stack", err.Stack),
+			)
+			c.forget(req)
+			c.giveUp(req, err, req.Retry+1)
+		}
+	}()
+	c.process(req)
+}
+
+// safeHandleResult 处理解析结果，发生 panic 时丢弃剩余的数据
+func (c *Crawler) safeHandleResult(out *parseOutput) {
+	defer func() {
+		if v := recover(); v != nil {
+			atomic.AddInt64(&c.workerStats.Panics, 1)
+			c.Logger.Error("handle result panic",
+				zap.String("task", out.req.Task.Name),
+				zap.String("url", out.req.Url),
+				zap.Any("err", v),
+				zap.String("stack", string(debug.Stack())),
+			)
+		}
+	}()
+	c.handleResult(out)
+}
@@ -0,0 +1,63 @@
+package engine_test
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePanicDeadLettered(t *testing.T) {
+	f := &fakeFetcher{}
+	task := listTask("panic", 5)
+	task.Rule.Trunk["item"].ParseFunc = func(ctx *collect.Context) (collect.ParseResult, error) {
+		if strings.HasSuffix(ctx.Req.Url, "/item/0") {
+			panic("bad page")
+		}
+		return collect.ParseResult{}, nil
+	}
+	e := newTestEngine(f, engine.NewSchedule(), []*collect.Task{task}, engine.WithWorkCount(1))
+	runEngine(t, e, 5*time.Second)
+
+	// 发生 panic 的请求不再重试，其余请求照常处理
+	letters, err := e.DeadLetters()
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, "http://panic/item/0", letters[0].Request.Url)
+	assert.Contains(t, letters[0].Err, "bad page")
+	summary, _ := e.Summary("panic")
+	assert.EqualValues(t, 5, summary.Fetched)
+	assert.EqualValues(t, 1, summary.Failed)
+	assert.Len(t, f.fetched(), 6)
+	assert.EqualValues(t, 1, e.WorkerStats().Panics)
+}
+
+// panicScheduler 前 n 次 Pull 时 panic
+type panicScheduler struct {
+	engine.Scheduler
+	n int32
+}
+
+func (s *panicScheduler) Pull() *collect.Request {
+	if atomic.AddInt32(&s.n, -1) >= 0 {
+		panic("pull failed")
+	}
+	return s.Scheduler.Pull()
+}
+
+func TestWorkerRestart(t *testing.T) {
+	s := &panicScheduler{Scheduler: engine.NewSchedule(), n: 2}
+	e := newTestEngine(&fakeFetcher{}, s, []*collect.Task{listTask("restart", 3)}, engine.WithWorkCount(1))
+	runEngine(t, e, 5*time.Second)
+
+	// worker 退出后重新启动，任务仍然完成
+	summary, _ := e.Summary("restart")
+	assert.EqualValues(t, 4, summary.Fetched)
+	stats := e.WorkerStats()
+	assert.EqualValues(t, 2, stats.Restarts)
+}
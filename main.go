@@ -10,6 +10,9 @@ import (
 	"github.com/nico612/crawler-go/engine"
 	"github.com/nico612/crawler-go/limiter"
 	"github.com/nico612/crawler-go/log"
+	"github.com/nico612/crawler-go/parse/doubanbook"
+	"github.com/nico612/crawler-go/parse/doubangroup"
+	"github.com/nico612/crawler-go/parse/doubangroupjs"
 	pb "github.com/nico612/crawler-go/proto/greeter"
 	"github.com/nico612/crawler-go/storage"
 	"github.com/nico612/crawler-go/storage/sqlstorage"
@@ -21,6 +24,8 @@ import (
 	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"net/http"
@@ -58,6 +63,12 @@ func main() {
 		//Proxy:   p,
 	}
 
+	// tasks
+	registry := engine.NewTaskRegistry()
+	registry.Add(doubangroup.DoubangroupTask)
+	registry.Add(doubanbook.DoubanBookTask)
+	registry.AddJSTask(doubangroupjs.DoubangroupJSTask)
+
 	// storage
 	var storage storage.Storage
 	var err error
@@ -65,6 +76,7 @@ func main() {
 		sqlstorage.WithSqlUrl("root:123456@tcp(127.0.0.1:3326)/crawler?charset=utf8"),
 		sqlstorage.WithLogger(logger.Named("sqlDB")),
 		sqlstorage.WithBatchCount(2),
+		sqlstorage.WithSchema(registry),
 	); err != nil {
 		logger.Error("create sqlstorage failed")
 		return
@@ -91,19 +103,32 @@ func main() {
 		engine.WithLogger(logger),
 		engine.WithWorkCount(5),
 		engine.WithSeeds(seeds),
+		engine.WithRegistry(registry),
 		engine.WithScheduler(engine.NewSchedule()),
 	)
 
+	// 收到退出信号后取消 ctx，引擎停止拉取新请求并刷新储存
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// worker start
-	go s.Run()
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
 
-	go HandleHttp()
+	go HandleHttp(ctx)
 
 	// start grpc server
-	HandleGrpc()
+	HandleGrpc(ctx)
+
+	// grpc 服务退出后，等待引擎处理完剩余的任务
+	stop()
+	<-done
 }
 
-func HandleGrpc() {
+func HandleGrpc(ctx context.Context) {
 
 	// etcd 注册中心
 	reg := etcdReg.NewRegistry(
@@ -116,6 +141,7 @@ func HandleGrpc() {
 		micro.Address(":9090"),       // 指定服务监听地址
 		micro.Registry(reg),
 		micro.Name("go.micro.server.worker"), // 服务器名字
+		micro.Context(ctx),
 	)
 	service.Init()
 	pb.RegisterGreeterHandler(service.Server(), new(Greeter))
@@ -124,8 +150,8 @@ func HandleGrpc() {
 	}
 }
 
-func HandleHttp() {
-	ctx, cancle := context.WithCancel(context.Background())
+func HandleHttp(ctx context.Context) {
+	ctx, cancle := context.WithCancel(ctx)
 	defer cancle()
 
 	mux := runtime.NewServeMux()
@@ -136,6 +162,11 @@ func HandleHttp() {
 		fmt.Println(err)
 	}
 
-	http.ListenAndServe(":8080", mux)
+	srv := &http.Server{Addr: ":8080", Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	srv.ListenAndServe()
 
 }
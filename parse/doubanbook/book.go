@@ -2,6 +2,8 @@ package doubanbook
 
 import (
 	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/pipeline"
+	"github.com/nico612/crawler-go/session"
 	"go.uber.org/zap"
 	"regexp"
 	"strconv"
@@ -9,11 +11,21 @@ import (
 
 var DoubanBookTask = &collect.Task{
 	Property: collect.Property{
-		Name:     "douban_book_list",
-		WaitTime: 2,
-		MaxDepth: 5,
-		Cookie:   "bid=-UXUw--yL5g; push_doumail_num=0; __utmv=30149280.21428; __utmc=30149280; __gads=ID=c6eaa3cb04d5733a-2259490c18d700e1:T=1666111347:RT=1666111347:S=ALNI_MaonVB4VhlZG_Jt25QAgq-17DGDfw; frodotk_db=\"17dfad2f83084953479f078e8918dbf9\"; gr_user_id=cecf9a7f-2a69-4dfd-8514-343ca5c61fb7; __utmc=81379588; _vwo_uuid_v2=D55C74107BD58A95BEAED8D4E5B300035|b51e2076f12dc7b2c24da50b77ab3ffe; __yadk_uid=BKBuETKRjc2fmw3QZuSw4rigUGsRR4wV; ct=y; ll=\"108288\"; viewed=\"36104107\"; ap_v=0,6.0; __gpi=UID=000008887412003e:T=1666111347:RT=1668851750:S=ALNI_MZmNsuRnBrad4_ynFUhTl0Hi0l5oA; __utma=30149280.2072705865.1665849857.1668851747.1668854335.25; __utmz=30149280.1668854335.25.4.utmcsr=douban.com|utmccn=(referral)|utmcmd=referral|utmcct=/misc/sorry; __utma=81379588.990530987.1667661846.1668852024.1668854335.8; __utmz=81379588.1668854335.8.2.utmcsr=douban.com|utmccn=(referral)|utmcmd=referral|utmcct=/misc/sorry; _pk_ref.100001.3ac3=[\"\",\"\",1668854335,\"https://www.douban.com/misc/sorry?original-url=https%3A%2F%2Fbook.douban.com%2Ftag%2F%25E5%25B0%258F%25E8%25AF%25B4\"]; _pk_ses.100001.3ac3=*; gr_cs1_5f43ac5c-3e30-4ffd-af0e-7cd5aadeb3d1=user_id:0; __utmt=1; dbcl2=\"214281202:GLkwnNqtJa8\"; ck=dBZD; gr_session_id_22c937bbd8ebd703f2d8e9445f7dfd03=ca04de17-2cbf-4e45-914a-428d3c26cfe3; gr_cs1_ca04de17-2cbf-4e45-914a-428d3c26cfe3=user_id:1; __utmt_douban=1; gr_session_id_22c937bbd8ebd703f2d8e9445f7dfd03_ca04de17-2cbf-4e45-914a-428d3c26cfe3=true; __utmb=30149280.10.10.1668854335; __utmb=81379588.9.10.1668854335; _pk_id.100001.3ac3=02339dd9cc7d293a.1667661846.8.1668855011.1668852362.; push_noty_num=0",
+		Name:      "douban_book_list",
+		WaitTime:  2,
+		MaxDepth:  5,
+		Canonical: collect.DefaultCanonical.Drop("from"), // 豆瓣的站内链接带有来源参数 from
+		Session:   session.Options{Dir: "data/session"},
 	},
+	// 请求过于频繁时豆瓣会跳转到 /misc/sorry 验证页面
+	Validators: []collect.Validator{
+		collect.MinSize(1),
+		collect.Banned(collect.NotMatch(`/misc/sorry|检测到有异常请求`)),
+	},
+	Pipeline: pipeline.New(
+		pipeline.TrimSpace(),
+		pipeline.Required("书名"),
+	),
 	Rule: collect.RuleTree{
 		Root: func() ([]*collect.Request, error) {
 			roots := []*collect.Request{
@@ -2,6 +2,7 @@ package doubangroupjs
 
 import (
 	"github.com/nico612/crawler-go/collect"
+	"github.com/nico612/crawler-go/session"
 )
 
 var DoubangroupJSTask = &collect.TaskModel{
@@ -9,7 +10,7 @@ var DoubangroupJSTask = &collect.TaskModel{
 		Name:     "js_find_douban_sun_room",
 		WaitTime: 2,
 		MaxDepth: 5,
-		Cookie:   "bid=-UXUw--yL5g; dbcl2=\"214281202:q0BBm9YC2Yg\"; __yadk_uid=jigAbrEOKiwgbAaLUt0G3yPsvehXcvrs; push_noty_num=0; push_doumail_num=0; __utmz=30149280.1665849857.1.1.utmcsr=accounts.douban.com|utmccn=(referral)|utmcmd=referral|utmcct=/; __utmv=30149280.21428; ck=SAvm; _pk_ref.100001.8cb4=%5B%22%22%2C%22%22%2C1665925405%2C%22https%3A%2F%2Faccounts.douban.com%2F%22%5D; _pk_ses.100001.8cb4=*; __utma=30149280.2072705865.1665849857.1665849857.1665925407.2; __utmc=30149280; __utmt=1; __utmb=30149280.23.5.1665925419338; _pk_id.100001.8cb4=fc1581490bf2b70c.1665849856.2.1665925421.1665849856.",
+		Session:  session.Options{Dir: "data/session"},
 	},
 	Root: `
 		var arr = new Array();
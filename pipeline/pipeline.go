@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nico612/crawler-go/storage"
+	"sync"
+)
+
+// 数据处理管道
+// 解析得到的数据在储存之前依次经过管道中的处理器，处理器可以修改数据，也可以丢弃数据或判定数据处理失败。
+// 管道记录每个处理器处理、丢弃和失败的数据条数。
+
+// DropError 数据被丢弃的原因
+type DropError struct {
+	Reason string
+}
+
+func (e *DropError) Error() string {
+	return "item dropped: " + e.Reason
+}
+
+// Drop 返回丢弃数据的错误
+func Drop(format string, args ...interface{}) error {
+	return &DropError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// IsDrop 数据是否被丢弃
+func IsDrop(err error) bool {
+	var d *DropError
+	return errors.As(err, &d)
+}
+
+// Processor 数据处理器，返回 Drop 错误时丢弃数据，返回其他错误时数据处理失败
+type Processor interface {
+	Name() string
+	Process(item *storage.DataCell) error
+}
+
+// Stats 处理器的统计
+type Stats struct {
+	Name    string
+	In      int64 // 处理的数据条数
+	Dropped int64 // 丢弃的数据条数
+	Failed  int64 // 处理失败的数据条数
+}
+
+// Pipeline 数据处理管道，可以并发使用
+type Pipeline struct {
+	processors []Processor
+	mu         sync.Mutex
+	stats      []Stats
+}
+
+func New(processors ...Processor) *Pipeline {
+	p := &Pipeline{}
+	p.Use(processors...)
+	return p
+}
+
+// Use 在管道末尾添加处理器
+func (p *Pipeline) Use(processors ...Processor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, proc := range processors {
+		p.processors = append(p.processors, proc)
+		p.stats = append(p.stats, Stats{Name: proc.Name()})
+	}
+}
+
+// Clone 复制管道，复制后的管道可以单独添加处理器，统计从零开始，处理器本身仍然共用
+func (p *Pipeline) Clone() *Pipeline {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := &Pipeline{processors: append([]Processor(nil), p.processors...)}
+	for _, proc := range c.processors {
+		c.stats = append(c.stats, Stats{Name: proc.Name()})
+	}
+	return c
+}
+
+// Process 依次执行处理器，返回第一个处理器的错误，错误中带有处理器的名称
+func (p *Pipeline) Process(item *storage.DataCell) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	processors := p.processors
+	p.mu.Unlock()
+
+	for i, proc := range processors {
+		err := proc.Process(item)
+		p.mu.Lock()
+		p.stats[i].In++
+		switch {
+		case err == nil:
+		case IsDrop(err):
+			p.stats[i].Dropped++
+		default:
+			p.stats[i].Failed++
+		}
+		p.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("%s: %w", proc.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Stats 按处理器顺序返回统计
+func (p *Pipeline) Stats() []Stats {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Stats(nil), p.stats...)
+}
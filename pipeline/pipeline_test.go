@@ -0,0 +1,74 @@
+package pipeline_test
+
+import (
+	"github.com/nico612/crawler-go/dedup"
+	"github.com/nico612/crawler-go/pipeline"
+	"github.com/nico612/crawler-go/storage"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func item(data map[string]interface{}) *storage.DataCell {
+	return &storage.DataCell{Data: map[string]interface{}{
+		"Task": "douban_book_list",
+		"Rule": "书籍简介",
+		"Url":  "https://book.douban.com/subject/1",
+		"Data": data,
+	}}
+}
+
+func TestPipeline(t *testing.T) {
+	p := pipeline.New(
+		pipeline.TrimSpace(),
+		pipeline.Required("书名"),
+		pipeline.Convert("页数", pipeline.ToInt),
+		pipeline.Unique(dedup.NewMapDeduper(), "书名"),
+		pipeline.Enrich("来源", func(item *storage.DataCell) interface{} { return item.Data["Task"] }),
+	)
+
+	ok := item(map[string]interface{}{"书名": "  活着 ", "页数": "191"})
+	require.NoError(t, p.Process(ok))
+	data := ok.Data["Data"].(map[string]interface{})
+	assert.Equal(t, "活着", data["书名"])
+	assert.Equal(t, int64(191), data["页数"])
+	assert.Equal(t, "douban_book_list", data["来源"])
+
+	err := p.Process(item(map[string]interface{}{"书名": " "}))
+	assert.True(t, pipeline.IsDrop(err))
+
+	err = p.Process(item(map[string]interface{}{"书名": "兄弟", "页数": "未知"}))
+	require.Error(t, err)
+	assert.False(t, pipeline.IsDrop(err))
+
+	err = p.Process(item(map[string]interface{}{"书名": "活着", "页数": "191"}))
+	assert.True(t, pipeline.IsDrop(err))
+
+	assert.Equal(t, []pipeline.Stats{
+		{Name: "trim_space", In: 4},
+		{Name: "required", In: 4, Dropped: 1},
+		{Name: "convert_页数", In: 3, Failed: 1},
+		{Name: "unique", In: 2, Dropped: 1},
+		{Name: "enrich_来源", In: 1},
+	}, p.Stats())
+}
+
+func TestUniqueConcurrent(t *testing.T) {
+	p := pipeline.New(pipeline.Unique(dedup.NewMapDeduper(), "书名"))
+	var kept int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p.Process(item(map[string]interface{}{"书名": "活着"})) == nil {
+				atomic.AddInt64(&kept, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, kept)
+}
@@ -0,0 +1,156 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nico612/crawler-go/dedup"
+	"github.com/nico612/crawler-go/storage"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 常用的处理器，字段指 DataCell 中 Data 字段的 map 里的键
+
+var errNotMap = errors.New("item data is not a map")
+
+// fields 返回数据字段
+func fields(item *storage.DataCell) (map[string]interface{}, error) {
+	data, ok := item.Data["Data"].(map[string]interface{})
+	if !ok {
+		return nil, errNotMap
+	}
+	return data, nil
+}
+
+// funcProcessor 由函数实现的处理器
+type funcProcessor struct {
+	name string
+	f    func(item *storage.DataCell) error
+}
+
+func (p funcProcessor) Name() string                         { return p.name }
+func (p funcProcessor) Process(item *storage.DataCell) error { return p.f(item) }
+
+// Func 由函数创建处理器
+func Func(name string, f func(item *storage.DataCell) error) Processor {
+	return funcProcessor{name: name, f: f}
+}
+
+// Required 要求字段存在且不为空字符串，否则丢弃数据
+func Required(names ...string) Processor {
+	return Func("required", func(item *storage.DataCell) error {
+		data, err := fields(item)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			v, ok := data[name]
+			if s, isString := v.(string); !ok || v == nil || (isString && strings.TrimSpace(s) == "") {
+				return Drop("missing field %s", name)
+			}
+		}
+		return nil
+	})
+}
+
+// TrimSpace 去掉字符串字段首尾的空白并将连续的空白合并为一个空格，names 为空时处理所有字符串字段
+func TrimSpace(names ...string) Processor {
+	return Func("trim_space", func(item *storage.DataCell) error {
+		data, err := fields(item)
+		if err != nil {
+			return err
+		}
+		trim := func(name string) {
+			if s, ok := data[name].(string); ok {
+				data[name] = strings.Join(strings.Fields(s), " ")
+			}
+		}
+		if len(names) == 0 {
+			for name := range data {
+				trim(name)
+			}
+			return nil
+		}
+		for _, name := range names {
+			trim(name)
+		}
+		return nil
+	})
+}
+
+// Convert 转换字段的类型，字段不存在时跳过，转换失败时数据处理失败
+func Convert(name string, conv func(v interface{}) (interface{}, error)) Processor {
+	return Func("convert_"+name, func(item *storage.DataCell) error {
+		data, err := fields(item)
+		if err != nil {
+			return err
+		}
+		v, ok := data[name]
+		if !ok {
+			return nil
+		}
+		nv, err := conv(v)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+		data[name] = nv
+		return nil
+	})
+}
+
+// ToInt 将字符串转换为 int64，忽略首尾空白
+func ToInt(v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok {
+		return v, nil
+	}
+	return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+}
+
+// ToFloat 将字符串转换为 float64，忽略首尾空白
+func ToFloat(v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok {
+		return v, nil
+	}
+	return strconv.ParseFloat(strings.TrimSpace(s), 64)
+}
+
+// Unique 根据字段的值去重，重复的数据被丢弃，names 为空时使用数据的 Url。
+// 检查和记录在同一个锁内完成，多个 worker 同时处理相同的数据时只保留一条。
+func Unique(d dedup.Deduper, names ...string) Processor {
+	var mu sync.Mutex
+	return Func("unique", func(item *storage.DataCell) error {
+		key := fmt.Sprint(item.Data["Task"], "|")
+		if len(names) == 0 {
+			key += fmt.Sprint(item.Data["Url"])
+		} else {
+			data, err := fields(item)
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				key += fmt.Sprint(data[name], "|")
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if d.Has(key) {
+			return Drop("duplicate item")
+		}
+		return d.Add(key)
+	})
+}
+
+// Enrich 为数据添加字段，value 根据数据计算字段的值
+func Enrich(name string, value func(item *storage.DataCell) interface{}) Processor {
+	return Func("enrich_"+name, func(item *storage.DataCell) error {
+		data, err := fields(item)
+		if err != nil {
+			return err
+		}
+		data[name] = value(item)
+		return nil
+	})
+}
@@ -0,0 +1,124 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cookie 文件格式
+// Netscape 格式是 curl、wget 和浏览器插件常用的 cookies.txt 格式，每行一个 cookie，字段以 tab 分隔；
+// JSON 格式是 cookie 对象的数组，兼容浏览器插件导出的 expirationDate、httpOnly 等字段。
+
+const netscapeHttpOnly = "#HttpOnly_"
+
+// ReadNetscape 读取 Netscape 格式的 cookie
+func ReadNetscape(r io.Reader) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, netscapeHttpOnly)
+		if httpOnly {
+			line = strings.TrimPrefix(line, netscapeHttpOnly)
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d: expect 7 fields, got %d", n, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid expiry %q", n, fields[4])
+		}
+		domain := fields[0]
+		// includeSubdomains 为 TRUE 时对子域名同样有效
+		if strings.EqualFold(fields[1], "TRUE") && !strings.HasPrefix(domain, ".") {
+			domain = "." + domain
+		}
+		c := &http.Cookie{
+			Domain:   domain,
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies, scanner.Err()
+}
+
+// cookieRecord JSON 格式的 cookie
+type cookieRecord struct {
+	Name           string  `json:"name"`
+	Value          string  `json:"value"`
+	Domain         string  `json:"domain"`
+	Path           string  `json:"path,omitempty"`
+	Expires        int64   `json:"expires,omitempty"`        // Unix 时间，秒
+	ExpirationDate float64 `json:"expirationDate,omitempty"` // 浏览器插件导出的过期时间
+	HostOnly       bool    `json:"hostOnly,omitempty"`       // 只对 domain 本身有效，为 false 时对子域名同样有效
+	Secure         bool    `json:"secure,omitempty"`
+	HttpOnly       bool    `json:"httpOnly,omitempty"`
+}
+
+func newCookieRecord(c *http.Cookie) cookieRecord {
+	rec := cookieRecord{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		HostOnly: !strings.HasPrefix(c.Domain, "."),
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+	if !c.Expires.IsZero() {
+		rec.Expires = c.Expires.Unix()
+	}
+	return rec
+}
+
+func (rec cookieRecord) cookie() *http.Cookie {
+	c := &http.Cookie{
+		Name:     rec.Name,
+		Value:    rec.Value,
+		Domain:   rec.Domain,
+		Path:     rec.Path,
+		Secure:   rec.Secure,
+		HttpOnly: rec.HttpOnly,
+	}
+	// 浏览器插件导出的 domain 不以 . 开头，由 hostOnly 区分是否对子域名有效
+	if !rec.HostOnly && !strings.HasPrefix(c.Domain, ".") {
+		c.Domain = "." + c.Domain
+	}
+	switch {
+	case rec.Expires > 0:
+		c.Expires = time.Unix(rec.Expires, 0)
+	case rec.ExpirationDate > 0:
+		c.Expires = time.Unix(int64(rec.ExpirationDate), 0)
+	}
+	return c
+}
+
+// ReadJSON 读取 JSON 格式的 cookie
+func ReadJSON(r io.Reader) ([]*http.Cookie, error) {
+	var records []cookieRecord
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, err
+	}
+	cookies := make([]*http.Cookie, 0, len(records))
+	for _, rec := range records {
+		cookies = append(cookies, rec.cookie())
+	}
+	return cookies, nil
+}
@@ -0,0 +1,155 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 会话池
+// 一个任务可以有多个相互独立的会话，例如多个账号，请求轮流使用不同的会话。
+// 设置了 Dir 时，会话保存在 Dir/<任务名>/<会话名>.json 中，下次启动时优先读取保存的会话；
+// 也可以将 Netscape 格式的 <会话名>.txt 放入该目录作为初始的 cookie。
+
+// DefaultName 没有配置任何会话时创建的会话名
+const DefaultName = "default"
+
+// Options 任务的会话配置
+type Options struct {
+	Dir   string   `json:"dir"`   // 会话保存的目录，为空时不保存到磁盘
+	Files []string `json:"files"` // 初始的 cookie 文件，每个文件对应一个会话，会话名为文件名
+	Count int      `json:"count"` // 至少需要的会话数，不足时创建空会话，默认 1
+}
+
+// Enabled 是否配置了会话
+func (o Options) Enabled() bool {
+	return o.Dir != "" || len(o.Files) > 0 || o.Count > 0
+}
+
+// Pool 任务的会话池
+type Pool struct {
+	dir      string
+	mu       sync.Mutex
+	sessions []*Session
+	next     int
+}
+
+// NewPool 创建会话池，name 为任务名
+func NewPool(name string, opts Options) (*Pool, error) {
+	p := &Pool{}
+	if opts.Dir != "" {
+		p.dir = filepath.Join(opts.Dir, name)
+		if err := os.MkdirAll(p.dir, 0700); err != nil {
+			return nil, err
+		}
+		// 先读取保存的会话，再读取放入目录中的 Netscape 格式的 cookie 文件
+		saved, err := filepath.Glob(filepath.Join(p.dir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		seeds, err := filepath.Glob(filepath.Join(p.dir, "*.txt"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(saved)
+		sort.Strings(seeds)
+		for _, file := range append(saved, seeds...) {
+			if p.Get(fileName(file)) != nil {
+				continue
+			}
+			s := New(fileName(file))
+			if err := s.LoadFile(file); err != nil {
+				return nil, err
+			}
+			p.sessions = append(p.sessions, s)
+		}
+	}
+	for _, file := range opts.Files {
+		if p.Get(fileName(file)) != nil {
+			continue
+		}
+		s := New(fileName(file))
+		if err := s.LoadFile(file); err != nil {
+			return nil, err
+		}
+		p.sessions = append(p.sessions, s)
+	}
+	count := opts.Count
+	if count < 1 {
+		count = 1
+	}
+	for i := 0; len(p.sessions) < count; i++ {
+		name := DefaultName
+		if i > 0 {
+			name += "-" + strconv.Itoa(i)
+		}
+		if p.Get(name) == nil {
+			p.sessions = append(p.sessions, New(name))
+		}
+	}
+	return p, nil
+}
+
+// fileName 返回去掉目录和扩展名的文件名
+func fileName(file string) string {
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Get 根据名称返回会话，不存在时返回 nil
+func (p *Pool) Get(name string) *Session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range p.sessions {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Next 轮流返回会话
+func (p *Pool) Next() *Session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.sessions[p.next%len(p.sessions)]
+	p.next++
+	return s
+}
+
+// Add 加入会话，已有同名会话时替换
+func (p *Pool) Add(s *Session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, old := range p.sessions {
+		if old.Name == s.Name {
+			p.sessions[i] = s
+			return
+		}
+	}
+	p.sessions = append(p.sessions, s)
+}
+
+// Sessions 返回所有会话
+func (p *Pool) Sessions() []*Session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Session(nil), p.sessions...)
+}
+
+// Save 将所有会话保存到磁盘，没有设置 Dir 时不做任何事，返回第一个保存失败的错误
+func (p *Pool) Save() error {
+	if p.dir == "" {
+		return nil
+	}
+	var first error
+	for _, s := range p.Sessions() {
+		if err := s.Save(filepath.Join(p.dir, s.Name+".json")); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,160 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// 会话
+// Session 是一个带有 cookie 的 http.CookieJar，响应中的 Set-Cookie 会保存到会话中，之后的请求自动带上。
+// 标准库的 cookiejar 无法列出所有的 cookie，因此 Session 另外记录完整的 cookie，用于保存到磁盘。
+
+// Session 一个独立的会话，例如一个账号
+type Session struct {
+	Name string
+
+	jar     *cookiejar.Jar
+	mu      sync.Mutex
+	cookies map[string]*http.Cookie // k: domain|path|name
+}
+
+// New 创建空的会话
+func New(name string) *Session {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return &Session{
+		Name:    name,
+		jar:     jar,
+		cookies: make(map[string]*http.Cookie),
+	}
+}
+
+// SetCookies 实现 http.CookieJar，记录响应设置的 cookie
+func (s *Session) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	s.jar.SetCookies(u, cookies)
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range cookies {
+		saved := *c
+		if saved.Domain == "" {
+			saved.Domain = u.Hostname()
+		} else if !strings.HasPrefix(saved.Domain, ".") {
+			saved.Domain = "." + saved.Domain
+		}
+		if saved.Path == "" || saved.Path[0] != '/' {
+			saved.Path = defaultPath(u.Path)
+		}
+		if saved.MaxAge > 0 {
+			saved.Expires = now.Add(time.Duration(saved.MaxAge) * time.Second)
+			saved.MaxAge = 0
+		}
+		key := saved.Domain + "|" + saved.Path + "|" + saved.Name
+		if c.MaxAge < 0 || (!saved.Expires.IsZero() && saved.Expires.Before(now)) {
+			delete(s.cookies, key)
+			continue
+		}
+		s.cookies[key] = &saved
+	}
+}
+
+// Cookies 实现 http.CookieJar
+func (s *Session) Cookies(u *url.URL) []*http.Cookie {
+	return s.jar.Cookies(u)
+}
+
+// All 返回会话中所有未过期的 cookie，Domain 以 . 开头的 cookie 对子域名同样有效
+func (s *Session) All() []*http.Cookie {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cookies := make([]*http.Cookie, 0, len(s.cookies))
+	for _, c := range s.cookies {
+		if !c.Expires.IsZero() && c.Expires.Before(now) {
+			continue
+		}
+		cc := *c
+		cookies = append(cookies, &cc)
+	}
+	return cookies
+}
+
+// Add 将 cookie 加入会话，cookie 的 Domain 必须设置，以 . 开头时对子域名同样有效
+func (s *Session) Add(cookies ...*http.Cookie) {
+	for _, c := range cookies {
+		host := strings.TrimPrefix(c.Domain, ".")
+		if host == "" {
+			continue
+		}
+		cc := *c
+		if !strings.HasPrefix(c.Domain, ".") {
+			// 不设置 Domain 时 cookiejar 将 cookie 视为只属于该主机
+			cc.Domain = ""
+		}
+		p := c.Path
+		if p == "" {
+			p = "/"
+		}
+		s.SetCookies(&url.URL{Scheme: "https", Host: host, Path: p}, []*http.Cookie{&cc})
+	}
+}
+
+// defaultPath 返回 cookie 的默认路径
+func defaultPath(p string) string {
+	if p == "" || p[0] != '/' {
+		return "/"
+	}
+	dir := path.Dir(p)
+	if dir == "." {
+		return "/"
+	}
+	return dir
+}
+
+// Save 将会话保存为 JSON 文件
+func (s *Session) Save(file string) error {
+	cookies := s.All()
+	records := make([]cookieRecord, 0, len(cookies))
+	for _, c := range cookies {
+		records = append(records, newCookieRecord(c))
+	}
+	b, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// LoadFile 从文件中读取 cookie，.json 文件按 JSON 格式读取，其余按 Netscape 格式读取
+func (s *Session) LoadFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var cookies []*http.Cookie
+	if strings.EqualFold(path.Ext(file), ".json") {
+		cookies, err = ReadJSON(f)
+	} else {
+		cookies, err = ReadNetscape(f)
+	}
+	if err != nil {
+		return fmt.Errorf("load %s: %w", file, err)
+	}
+	s.Add(cookies...)
+	return nil
+}
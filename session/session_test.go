@@ -0,0 +1,67 @@
+package session_test
+
+import (
+	"github.com/nico612/crawler-go/session"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const netscape = "# Netscape HTTP Cookie File\n" +
+	".douban.com\tTRUE\t/\tFALSE\t4102444800\tbid\tabc\n" +
+	"#HttpOnly_www.douban.com\tFALSE\t/\tTRUE\t0\tdbcl2\t\"1:x\"\n"
+
+func TestReadNetscape(t *testing.T) {
+	cookies, err := session.ReadNetscape(strings.NewReader(netscape))
+	require.NoError(t, err)
+	require.Len(t, cookies, 2)
+	assert.Equal(t, ".douban.com", cookies[0].Domain)
+	assert.Equal(t, int64(4102444800), cookies[0].Expires.Unix())
+	assert.Equal(t, "www.douban.com", cookies[1].Domain)
+	assert.True(t, cookies[1].HttpOnly)
+	assert.True(t, cookies[1].Secure)
+
+	_, err = session.ReadNetscape(strings.NewReader("douban.com\tTRUE\t/\n"))
+	assert.Error(t, err)
+}
+
+func TestPool(t *testing.T) {
+	dir := t.TempDir()
+	seed := filepath.Join(dir, "account1.txt")
+	require.NoError(t, os.WriteFile(seed, []byte(netscape), 0600))
+
+	pool, err := session.NewPool("douban", session.Options{Dir: dir, Files: []string{seed}, Count: 2})
+	require.NoError(t, err)
+	require.Len(t, pool.Sessions(), 2)
+	assert.Equal(t, "account1", pool.Next().Name)
+	assert.Equal(t, session.DefaultName, pool.Next().Name)
+	assert.Equal(t, "account1", pool.Next().Name)
+
+	s := pool.Get("account1")
+	u, _ := url.Parse("https://book.douban.com/tag/")
+	assert.Equal(t, []*http.Cookie{{Name: "bid", Value: "abc"}}, s.Cookies(u))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "ck", Value: "v1", Path: "/", MaxAge: 3600})
+	}))
+	defer srv.Close()
+	client := &http.Client{Jar: s}
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.NoError(t, pool.Save())
+
+	pool, err = session.NewPool("douban", session.Options{Dir: dir})
+	require.NoError(t, err)
+	require.Len(t, pool.Sessions(), 2)
+	su, _ := url.Parse(srv.URL)
+	assert.Equal(t, []*http.Cookie{{Name: "ck", Value: "v1"}}, pool.Get("account1").Cookies(su))
+	assert.Len(t, pool.Get("account1").All(), 3)
+}
@@ -1,17 +1,21 @@
 package sqlstorage
 
 import (
+	"github.com/nico612/crawler-go/storage"
 	"go.uber.org/zap"
 )
 
 type options struct {
 	logger     *zap.Logger
 	sqlUrl     string
-	BatchCount int // 批量数
+	BatchCount int            // 批量数
+	FlushRetry int            // 一批数据写入失败后最多尝试的次数，超过后丢弃
+	schema     storage.Schema // 数据字段，用于建表
 }
 
 var defaultOptions = options{
-	logger: zap.NewNop(),
+	logger:     zap.NewNop(),
+	FlushRetry: 3,
 }
 
 type Option func(opts *options)
@@ -33,3 +37,16 @@ func WithBatchCount(batchCount int) Option {
 		opts.BatchCount = batchCount
 	}
 }
+
+// WithFlushRetry 设置一批数据写入失败后最多尝试的次数
+func WithFlushRetry(attempts int) Option {
+	return func(opts *options) {
+		opts.FlushRetry = attempts
+	}
+}
+
+func WithSchema(schema storage.Schema) Option {
+	return func(opts *options) {
+		opts.schema = schema
+	}
+}
@@ -2,15 +2,19 @@ package sqlstorage
 
 import (
 	"encoding/json"
-	"github.com/nico612/crawler-go/engine"
+	"errors"
+	"fmt"
 	"github.com/nico612/crawler-go/sqldb"
 	"github.com/nico612/crawler-go/storage"
-
 	"go.uber.org/zap"
+	"sync"
 )
 
+// SqlStorage 将数据分批写入 MySQL，可以并发使用
 type SqlStorage struct {
+	mu          sync.Mutex
 	dataDocker  []*storage.DataCell //分批输出结果缓存
+	failures    map[string]int      // 每张表连续写入失败的次数
 	columnNames []sqldb.Field       // 标题字段
 	db          sqldb.DBer
 	Table       map[string]struct{}
@@ -23,8 +27,12 @@ func New(opts ...Option) (*SqlStorage, error) {
 		opt(&options)
 	}
 	s := &SqlStorage{}
+	if options.schema == nil {
+		return nil, errors.New("sqlstorage: schema is required")
+	}
 	s.options = options
 	s.Table = make(map[string]struct{})
+	s.failures = make(map[string]int)
 	var err error
 	s.db, err = sqldb.New(
 		sqldb.WithConnUrl(s.sqlUrl),
@@ -37,37 +45,41 @@ func New(opts ...Option) (*SqlStorage, error) {
 	return s, nil
 }
 
+// Save 缓存数据，缓存满时先写入已缓存的数据。
+// 一次调用的数据要么全部缓存，要么全部不缓存并返回错误：建表失败，
+// 或者之前缓存的数据写入失败时都不缓存本次的数据，调用方可以稍后重试。
 func (s *SqlStorage) Save(dataCells ...*storage.DataCell) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for _, cell := range dataCells {
 		name := cell.GetTableName()
-		if _, ok := s.Table[name]; !ok {
-			// 创建表
-			columnNames := getFields(cell)
-
-			err := s.db.CreateTable(sqldb.TableData{
-				TableName:   name,
-				ColumnNames: columnNames,
-				AutoKey:     true,
-			})
-			if err != nil {
-				s.logger.Error("create table falied", zap.Error(err))
-			}
-			s.Table[name] = struct{}{}
+		if _, ok := s.Table[name]; ok {
+			continue
 		}
-		if len(s.dataDocker) >= s.BatchCount {
-			if err := s.Flush(); err != nil {
-				s.logger.Error("insert data failed", zap.Error(err))
-			}
+		// 创建表
+		err := s.db.CreateTable(sqldb.TableData{
+			TableName:   name,
+			ColumnNames: s.getFields(cell),
+			AutoKey:     true,
+		})
+		if err != nil {
+			return fmt.Errorf("create table %s: %w", name, err)
+		}
+		s.Table[name] = struct{}{}
+	}
+	if len(s.dataDocker) > 0 && len(s.dataDocker)+len(dataCells) > s.BatchCount {
+		if err := s.flush(); err != nil {
+			return err
 		}
-		s.dataDocker = append(s.dataDocker, cell)
 	}
+	s.dataDocker = append(s.dataDocker, dataCells...)
 	return nil
 }
 
-func getFields(cell *storage.DataCell) []sqldb.Field {
+func (s *SqlStorage) getFields(cell *storage.DataCell) []sqldb.Field {
 	taskName := cell.Data["Task"].(string)
 	ruleName := cell.Data["Rule"].(string)
-	fields := engine.GetFields(taskName, ruleName)
+	fields := s.schema.ItemFields(taskName, ruleName)
 
 	var columnNames []sqldb.Field
 	for _, field := range fields {
@@ -83,18 +95,67 @@ func getFields(cell *storage.DataCell) []sqldb.Field {
 	return columnNames
 }
 
-func (s *SqlStorage) Flush() (err error) {
-	if len(s.dataDocker) == 0 {
-		return nil
+// Flush 写入缓存的数据，返回第一个写入失败的错误
+func (s *SqlStorage) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flush()
+}
+
+// flush 按表分批写入缓存的数据。
+// 写入失败的一批数据留在缓存中等待下次写入，连续失败 FlushRetry 次后丢弃并记录日志，
+// 避免一条有问题的数据导致之后的所有写入都失败。
+func (s *SqlStorage) flush() error {
+	var tables []string
+	batches := make(map[string][]*storage.DataCell)
+	for _, cell := range s.dataDocker {
+		name := cell.GetTableName()
+		if _, ok := batches[name]; !ok {
+			tables = append(tables, name)
+		}
+		batches[name] = append(batches[name], cell)
 	}
-	defer func() {
-		s.dataDocker = nil
-	}()
+	s.dataDocker = nil
+
+	var first error
+	for _, name := range tables {
+		batch := batches[name]
+		err := s.insert(name, batch)
+		if err == nil {
+			delete(s.failures, name)
+			continue
+		}
+		if first == nil {
+			first = fmt.Errorf("insert data into %s: %w", name, err)
+		}
+		s.failures[name]++
+		if s.failures[name] < s.FlushRetry {
+			s.logger.Warn("insert data failed, retry later",
+				zap.Error(err),
+				zap.String("table", name),
+				zap.Int("count", len(batch)),
+				zap.Int("attempts", s.failures[name]),
+			)
+			s.dataDocker = append(s.dataDocker, batch...)
+			continue
+		}
+		delete(s.failures, name)
+		s.logger.Error("insert data failed, drop batch",
+			zap.Error(err),
+			zap.String("table", name),
+			zap.Int("count", len(batch)),
+		)
+	}
+	return first
+}
+
+// insert 将同一张表的数据写入数据库
+func (s *SqlStorage) insert(table string, cells []*storage.DataCell) error {
 	args := make([]interface{}, 0)
-	for _, datacell := range s.dataDocker {
+	for _, datacell := range cells {
 		ruleName := datacell.Data["Rule"].(string)
 		taskName := datacell.Data["Task"].(string)
-		fields := engine.GetFields(taskName, ruleName)
+		fields := s.schema.ItemFields(taskName, ruleName)
 		data := datacell.Data["Data"].(map[string]interface{})
 		value := []string{}
 		for _, field := range fields {
@@ -120,9 +181,9 @@ func (s *SqlStorage) Flush() (err error) {
 	}
 
 	return s.db.Insert(sqldb.TableData{
-		TableName:   s.dataDocker[0].GetTableName(),
-		ColumnNames: getFields(s.dataDocker[0]),
+		TableName:   table,
+		ColumnNames: s.getFields(cells[0]),
 		Args:        args,
-		DataCount:   len(s.dataDocker),
+		DataCount:   len(cells),
 	})
 }
@@ -0,0 +1,98 @@
+package sqlstorage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nico612/crawler-go/sqldb"
+	"github.com/nico612/crawler-go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fieldsSchema struct{}
+
+func (fieldsSchema) ItemFields(taskName, ruleName string) []string {
+	return []string{"name"}
+}
+
+// fakeDB 记录写入的数据条数，写入表 bad 或创建表 broken 时失败，
+// fails 中的表在前几次写入时失败
+type fakeDB struct {
+	inserted map[string]int
+	fails    map[string]int
+}
+
+func (db *fakeDB) CreateTable(t sqldb.TableData) error {
+	if t.TableName == "broken" {
+		return errors.New("create failed")
+	}
+	return nil
+}
+
+func (db *fakeDB) Insert(t sqldb.TableData) error {
+	if t.TableName == "bad" {
+		return errors.New("insert failed")
+	}
+	if db.fails[t.TableName] > 0 {
+		db.fails[t.TableName]--
+		return errors.New("insert failed")
+	}
+	db.inserted[t.TableName] += t.DataCount
+	return nil
+}
+
+func cell(task string) *storage.DataCell {
+	return &storage.DataCell{Data: map[string]interface{}{
+		"Task": task,
+		"Rule": "rule",
+		"Url":  "http://" + task,
+		"Time": "2022-01-01 00:00:00",
+		"Data": map[string]interface{}{"name": task},
+	}}
+}
+
+func newTestStorage(db *fakeDB, batch int) *SqlStorage {
+	s := &SqlStorage{db: db, Table: make(map[string]struct{}), failures: make(map[string]int)}
+	s.options = options{logger: zap.NewNop(), BatchCount: batch, FlushRetry: 3, schema: fieldsSchema{}}
+	return s
+}
+
+func TestSaveRetriesFailedBatch(t *testing.T) {
+	db := &fakeDB{inserted: make(map[string]int), fails: map[string]int{"flaky": 1}}
+	s := newTestStorage(db, 1)
+
+	require.NoError(t, s.Save(cell("flaky")))
+	// 之前缓存的数据写入失败，本次的数据不缓存，调用方重试
+	assert.Error(t, s.Save(cell("good")))
+	require.NoError(t, s.Save(cell("good")))
+	require.NoError(t, s.Flush())
+	assert.Equal(t, 1, db.inserted["flaky"])
+	assert.Equal(t, 1, db.inserted["good"])
+}
+
+func TestSaveDropsFailedBatch(t *testing.T) {
+	db := &fakeDB{inserted: make(map[string]int)}
+	s := newTestStorage(db, 1)
+
+	require.NoError(t, s.Save(cell("bad")))
+	for i := 0; i < 3; i++ {
+		assert.Error(t, s.Save(cell("good")))
+	}
+	// 连续失败 FlushRetry 次后丢弃，之后的数据不受影响
+	require.NoError(t, s.Save(cell("good")))
+	require.NoError(t, s.Flush())
+	assert.Equal(t, 1, db.inserted["good"])
+	assert.Equal(t, 0, db.inserted["bad"])
+}
+
+func TestSaveAllOrNothing(t *testing.T) {
+	db := &fakeDB{inserted: make(map[string]int)}
+	s := newTestStorage(db, 10)
+
+	assert.Error(t, s.Save(cell("good"), cell("broken")))
+	require.NoError(t, s.Save(cell("good")))
+	require.NoError(t, s.Flush())
+	assert.Equal(t, 1, db.inserted["good"])
+}
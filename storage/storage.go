@@ -15,3 +15,13 @@ func (d *DataCell) GetTaskName() string {
 type Storage interface {
 	Save(datas ...*DataCell) error
 }
+
+// Schema 提供任务中各个规则输出的数据字段，需要建表的储存使用
+type Schema interface {
+	ItemFields(taskName string, ruleName string) []string
+}
+
+// Flusher 带缓存的储存实现该接口，引擎停止时会调用 Flush 将缓存的数据写入
+type Flusher interface {
+	Flush() error
+}